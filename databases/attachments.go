@@ -0,0 +1,258 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/lib/pq"
+)
+
+const attachmentColumns = "id, post_id, user_id, storage_key, filename, content_type, size, width, height, status, created_at"
+
+// InsertAttachment refuses to go over MAX_ATTACHMENTS_PER_POST, checked in
+// the same statement so concurrent uploads cannot overshoot it by much.
+func (repo *PostgresRepository) InsertAttachment(ctx context.Context, attachment *models.Attachment) error {
+	err := repo.db.QueryRowContext(
+		ctx,
+		`INSERT INTO attachments (id, post_id, user_id, storage_key, filename, content_type, size, width, height, status)
+		SELECT $1, $2, $3, $4, $5, $6, $7, $8, $9, $10
+		WHERE (SELECT COUNT(*) FROM attachments WHERE post_id = $2) < $11
+		RETURNING created_at`,
+		attachment.Id,
+		attachment.PostId,
+		attachment.UserId,
+		attachment.StorageKey,
+		attachment.Filename,
+		attachment.ContentType,
+		attachment.Size,
+		attachment.Width,
+		attachment.Height,
+		attachment.Status,
+		models.MAX_ATTACHMENTS_PER_POST,
+	).Scan(&attachment.CreatedAt)
+	if err == sql.ErrNoRows {
+		return repository.ErrTooManyAttachments
+	}
+	return err
+}
+
+func (repo *PostgresRepository) GetAttachmentById(ctx context.Context, id string) (*models.Attachment, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	var attachment *models.Attachment
+	for rows.Next() {
+		if attachment, err = scanAttachment(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if attachment == nil {
+		return nil, nil
+	}
+	if err := repo.attachVariants(ctx, []*models.Attachment{attachment}); err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+func (repo *PostgresRepository) ListAttachments(ctx context.Context, postIds []string) (map[string][]*models.Attachment, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE post_id = ANY($1) ORDER BY created_at, id",
+		pq.Array(postIds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	attachments := make(map[string][]*models.Attachment)
+	all := make([]*models.Attachment, 0)
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments[attachment.PostId] = append(attachments[attachment.PostId], attachment)
+		all = append(all, attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := repo.attachVariants(ctx, all); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// ListProcessingAttachments returns the attachments still waiting for their
+// variants, oldest first.
+func (repo *PostgresRepository) ListProcessingAttachments(ctx context.Context) ([]*models.Attachment, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+attachmentColumns+" FROM attachments WHERE status = $1 ORDER BY created_at",
+		models.ATTACHMENT_STATUS_PROCESSING,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	attachments := make([]*models.Attachment, 0)
+	for rows.Next() {
+		attachment, err := scanAttachment(rows)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// CompleteAttachment stores what processing found out about the original
+// along with its variants, and marks the attachment ready.
+func (repo *PostgresRepository) CompleteAttachment(ctx context.Context, attachment *models.Attachment) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(
+		ctx,
+		"UPDATE attachments SET size = $2, width = $3, height = $4, status = $5 WHERE id = $1",
+		attachment.Id,
+		attachment.Size,
+		attachment.Width,
+		attachment.Height,
+		models.ATTACHMENT_STATUS_READY,
+	)
+	if err != nil {
+		return err
+	}
+	for _, variant := range attachment.Variants {
+		_, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO attachment_variants (attachment_id, name, storage_key, content_type, size, width, height)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (attachment_id, name) DO UPDATE
+			SET storage_key = $3, content_type = $4, size = $5, width = $6, height = $7`,
+			attachment.Id,
+			variant.Name,
+			variant.StorageKey,
+			variant.ContentType,
+			variant.Size,
+			variant.Width,
+			variant.Height,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	attachment.Status = models.ATTACHMENT_STATUS_READY
+	return nil
+}
+
+func (repo *PostgresRepository) SetAttachmentStatus(ctx context.Context, id string, status string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE attachments SET status = $2 WHERE id = $1",
+		id,
+		status,
+	)
+	return err
+}
+
+func (repo *PostgresRepository) attachVariants(ctx context.Context, attachments []*models.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	byId := make(map[string]*models.Attachment, len(attachments))
+	ids := make([]string, 0, len(attachments))
+	for _, attachment := range attachments {
+		byId[attachment.Id] = attachment
+		ids = append(ids, attachment.Id)
+	}
+
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT attachment_id, name, storage_key, content_type, size, width, height
+		FROM attachment_variants WHERE attachment_id = ANY($1) ORDER BY width`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return err
+	}
+	defer handleCloseCursor(rows)
+
+	for rows.Next() {
+		var attachmentId string
+		variant := models.AttachmentVariant{}
+		if err := rows.Scan(
+			&attachmentId,
+			&variant.Name,
+			&variant.StorageKey,
+			&variant.ContentType,
+			&variant.Size,
+			&variant.Width,
+			&variant.Height,
+		); err != nil {
+			return err
+		}
+		attachment := byId[attachmentId]
+		attachment.Variants = append(attachment.Variants, &variant)
+	}
+	return rows.Err()
+}
+
+func (repo *PostgresRepository) DeleteAttachment(ctx context.Context, id string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"DELETE FROM attachments WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+func scanAttachment(rows *sql.Rows) (*models.Attachment, error) {
+	attachment := models.Attachment{}
+	var width, height sql.NullInt32
+	if err := rows.Scan(
+		&attachment.Id,
+		&attachment.PostId,
+		&attachment.UserId,
+		&attachment.StorageKey,
+		&attachment.Filename,
+		&attachment.ContentType,
+		&attachment.Size,
+		&width,
+		&height,
+		&attachment.Status,
+		&attachment.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if width.Valid && height.Valid {
+		w, h := int(width.Int32), int(height.Int32)
+		attachment.Width, attachment.Height = &w, &h
+	}
+	return &attachment, nil
+}
@@ -0,0 +1,218 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// notBlocked is the condition that neither the viewer nor the author, both
+// SQL expressions, blocked the other.
+func notBlocked(viewer string, author string) string {
+	return fmt.Sprintf(
+		`NOT EXISTS (SELECT 1 FROM blocks WHERE (blocks.blocker_id = %[1]s AND blocks.blocked_id = %[2]s)
+		OR (blocks.blocker_id = %[2]s AND blocks.blocked_id = %[1]s))`,
+		viewer,
+		author,
+	)
+}
+
+// notMuted is the condition that the viewer did not mute the author.
+func notMuted(viewer string, author string) string {
+	return fmt.Sprintf(
+		"NOT EXISTS (SELECT 1 FROM mutes WHERE mutes.muter_id = %s AND mutes.muted_id = %s)",
+		viewer,
+		author,
+	)
+}
+
+// Block also ends the follows between both users, in either direction.
+func (repo *PostgresRepository) Block(ctx context.Context, blockerId string, blockedId string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO blocks (blocker_id, blocked_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		blockerId,
+		blockedId,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM follows WHERE (follower_id = $1 AND followed_id = $2)
+		OR (follower_id = $2 AND followed_id = $1)`,
+		blockerId,
+		blockedId,
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`DELETE FROM timeline_entries WHERE (user_id = $1 AND author_id = $2)
+		OR (user_id = $2 AND author_id = $1)`,
+		blockerId,
+		blockedId,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (repo *PostgresRepository) Unblock(ctx context.Context, blockerId string, blockedId string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"DELETE FROM blocks WHERE blocker_id = $1 AND blocked_id = $2",
+		blockerId,
+		blockedId,
+	)
+	return err
+}
+
+func (repo *PostgresRepository) ListBlocks(ctx context.Context, userId string) ([]*models.Block, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT blocked_id, created_at FROM blocks WHERE blocker_id = $1 ORDER BY created_at DESC",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	blocks := make([]*models.Block, 0)
+	for rows.Next() {
+		var block = models.Block{}
+		if err = rows.Scan(&block.UserId, &block.BlockedAt); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, &block)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return blocks, nil
+}
+
+func (repo *PostgresRepository) Mute(ctx context.Context, muterId string, mutedId string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"INSERT INTO mutes (muter_id, muted_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		muterId,
+		mutedId,
+	)
+	return err
+}
+
+func (repo *PostgresRepository) Unmute(ctx context.Context, muterId string, mutedId string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"DELETE FROM mutes WHERE muter_id = $1 AND muted_id = $2",
+		muterId,
+		mutedId,
+	)
+	return err
+}
+
+func (repo *PostgresRepository) ListMutes(ctx context.Context, userId string) ([]*models.Mute, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT muted_id, created_at FROM mutes WHERE muter_id = $1 ORDER BY created_at DESC",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	mutes := make([]*models.Mute, 0)
+	for rows.Next() {
+		var mute = models.Mute{}
+		if err = rows.Scan(&mute.UserId, &mute.MutedAt); err != nil {
+			return nil, err
+		}
+		mutes = append(mutes, &mute)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return mutes, nil
+}
+
+// AreBlocked tells whether either user blocked the other.
+func (repo *PostgresRepository) AreBlocked(ctx context.Context, userId string, otherId string) (bool, error) {
+	var blocked bool
+	err := repo.db.QueryRowContext(
+		ctx,
+		"SELECT NOT "+notBlocked("$1", "$2"),
+		userId,
+		otherId,
+	).Scan(&blocked)
+	return blocked, err
+}
+
+func (repo *PostgresRepository) IsMuted(ctx context.Context, muterId string, mutedId string) (bool, error) {
+	var muted bool
+	err := repo.db.QueryRowContext(
+		ctx,
+		"SELECT NOT "+notMuted("$1", "$2"),
+		muterId,
+		mutedId,
+	).Scan(&muted)
+	return muted, err
+}
+
+// ListExcludedUsers returns the users who must not be sent what userId does:
+// those blocking userId or blocked by them, and those who muted userId.
+func (repo *PostgresRepository) ListExcludedUsers(ctx context.Context, userId string) ([]string, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT blocker_id FROM blocks WHERE blocked_id = $1
+		UNION SELECT blocked_id FROM blocks WHERE blocker_id = $1
+		UNION SELECT muter_id FROM mutes WHERE muted_id = $1`,
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToIds(rows)
+}
+
+// ListHiddenUsers returns the users viewerId must not see: those blocking
+// viewerId or blocked by them, and those viewerId muted.
+func (repo *PostgresRepository) ListHiddenUsers(ctx context.Context, viewerId string) ([]string, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT blocker_id FROM blocks WHERE blocked_id = $1
+		UNION SELECT blocked_id FROM blocks WHERE blocker_id = $1
+		UNION SELECT muted_id FROM mutes WHERE muter_id = $1`,
+		viewerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToIds(rows)
+}
+
+func mapFromRowsToIds(rows *sql.Rows) ([]string, error) {
+	userIds := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		userIds = append(userIds, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return userIds, nil
+}
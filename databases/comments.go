@@ -0,0 +1,146 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/lib/pq"
+)
+
+func (repo *PostgresRepository) InsertComment(ctx context.Context, comment *models.Comment) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO comments (id, post_id, user_id, parent_id, depth, content) VALUES ($1, $2, $3, $4, $5, $6) RETURNING created_at, updated_at",
+		comment.Id,
+		comment.PostId,
+		comment.UserId,
+		comment.ParentId,
+		comment.Depth,
+		comment.Content,
+	).Scan(&comment.CreatedAt, &comment.UpdatedAt)
+}
+
+func (repo *PostgresRepository) GetCommentById(ctx context.Context, id string) (*models.Comment, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, post_id, user_id, parent_id, depth, content, created_at, updated_at FROM comments WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	var comment *models.Comment
+	for rows.Next() {
+		if comment, err = scanComment(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func (repo *PostgresRepository) UpdateComment(ctx context.Context, comment *models.Comment) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"UPDATE comments SET content = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at",
+		comment.Content,
+		comment.Id,
+	).Scan(&comment.UpdatedAt)
+}
+
+// DeleteComment removes the comment together with its replies.
+func (repo *PostgresRepository) DeleteComment(ctx context.Context, id string) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"DELETE FROM comments WHERE id = $1",
+		id,
+	)
+	return err
+}
+
+// ListComments leaves out the comments viewerId may not see: those of users
+// blocking them, blocked or muted by them.
+func (repo *PostgresRepository) ListComments(ctx context.Context, postId string, viewerId string) ([]*models.Comment, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT id, post_id, user_id, parent_id, depth, content, created_at, updated_at FROM comments
+		WHERE post_id = $1 AND `+notBlocked("$2", "comments.user_id")+` AND `+notMuted("$2", "comments.user_id")+`
+		ORDER BY created_at, id`,
+		postId,
+		viewerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	comments := make([]*models.Comment, 0)
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// GetCommentCounts counts the comments on each post that ListComments shows
+// to viewerId. Posts without any are left out.
+func (repo *PostgresRepository) GetCommentCounts(ctx context.Context, postIds []string, viewerId string) (map[string]uint64, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT post_id, COUNT(*) FROM comments
+		WHERE post_id = ANY($1) AND `+notBlocked("$2", "comments.user_id")+` AND `+notMuted("$2", "comments.user_id")+`
+		GROUP BY post_id`,
+		pq.Array(postIds),
+		viewerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	counts := make(map[string]uint64)
+	for rows.Next() {
+		var postId string
+		var count uint64
+		if err = rows.Scan(&postId, &count); err != nil {
+			return nil, err
+		}
+		counts[postId] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func scanComment(rows *sql.Rows) (*models.Comment, error) {
+	comment := models.Comment{}
+	var parentId sql.NullString
+	if err := rows.Scan(
+		&comment.Id,
+		&comment.PostId,
+		&comment.UserId,
+		&parentId,
+		&comment.Depth,
+		&comment.Content,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if parentId.Valid {
+		comment.ParentId = &parentId.String
+	}
+	return &comment, nil
+}
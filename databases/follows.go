@@ -0,0 +1,190 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// Timeline strategies. On read, the timeline is assembled from the follow
+// graph on every request. On write, each new post is copied to the
+// timeline_entries of the author's followers, making reads a single index
+// scan at the cost of heavier writes for popular authors.
+const (
+	TIMELINE_FAN_OUT_ON_READ  = "read"
+	TIMELINE_FAN_OUT_ON_WRITE = "write"
+
+	// how many recent posts are copied to a timeline on follow when fanning
+	// out on write
+	TIMELINE_BACKFILL = 100
+)
+
+func (repo *PostgresRepository) UseTimelineStrategy(strategy string) error {
+	switch strategy {
+	case "", TIMELINE_FAN_OUT_ON_READ:
+		repo.timelineStrategy = TIMELINE_FAN_OUT_ON_READ
+	case TIMELINE_FAN_OUT_ON_WRITE:
+		repo.timelineStrategy = TIMELINE_FAN_OUT_ON_WRITE
+	default:
+		return fmt.Errorf("unknown timeline strategy %q", strategy)
+	}
+	return nil
+}
+
+func (repo *PostgresRepository) Follow(ctx context.Context, followerId, followedId string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(
+		ctx,
+		"INSERT INTO follows (follower_id, followed_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+		followerId,
+		followedId,
+	)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected > 0 && repo.timelineStrategy == TIMELINE_FAN_OUT_ON_WRITE {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+			SELECT $1, id, user_id, created_at FROM posts WHERE user_id = $2 AND status = $4 AND deleted_at IS NULL
+			ORDER BY created_at DESC, id DESC LIMIT $3
+			ON CONFLICT DO NOTHING`,
+			followerId,
+			followedId,
+			TIMELINE_BACKFILL,
+			models.POST_PUBLISHED,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (repo *PostgresRepository) Unfollow(ctx context.Context, followerId, followedId string) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM follows WHERE follower_id = $1 AND followed_id = $2",
+		followerId,
+		followedId,
+	); err != nil {
+		return err
+	}
+	// cleared whatever the strategy, so switching strategies never leaves
+	// stale entries behind
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM timeline_entries WHERE user_id = $1 AND author_id = $2",
+		followerId,
+		followedId,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (repo *PostgresRepository) ListFollowers(ctx context.Context, userId string) ([]*models.Follow, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT follower_id, created_at FROM follows WHERE followed_id = $1 ORDER BY created_at DESC",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToFollows(rows)
+}
+
+func (repo *PostgresRepository) ListFollowing(ctx context.Context, userId string) ([]*models.Follow, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT followed_id, created_at FROM follows WHERE follower_id = $1 ORDER BY created_at DESC",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToFollows(rows)
+}
+
+// GetTimeline returns the posts of the users followed by userId, newest
+// first, starting after cursor when it is set. Muted users are left out.
+func (repo *PostgresRepository) GetTimeline(ctx context.Context, userId string, cursor *models.PostCursor, limit uint64) ([]*models.Post, error) {
+	var after sql.NullTime
+	var afterId string
+	if cursor != nil {
+		after = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		afterId = cursor.Id
+	}
+
+	query := `SELECT ` + postColumns + `
+		FROM posts JOIN follows f ON f.followed_id = posts.user_id
+		WHERE f.follower_id = $1 AND posts.status = $5 AND ` + visibleTo("$1", false) + `
+		AND ` + notMuted("$1", "posts.user_id") + `
+		AND ($2::timestamp IS NULL OR (posts.created_at, posts.id) < ($2, $3))
+		ORDER BY posts.created_at DESC, posts.id DESC LIMIT $4`
+	if repo.timelineStrategy == TIMELINE_FAN_OUT_ON_WRITE {
+		query = `SELECT ` + postColumns + `
+		FROM timeline_entries t JOIN posts ON posts.id = t.post_id
+		WHERE t.user_id = $1 AND posts.status = $5 AND ` + visibleTo("$1", false) + `
+		AND ` + notMuted("$1", "posts.user_id") + `
+		AND ($2::timestamp IS NULL OR (t.created_at, t.post_id) < ($2, $3))
+		ORDER BY t.created_at DESC, t.post_id DESC LIMIT $4`
+	}
+
+	rows, err := repo.db.QueryContext(ctx, query, userId, after, afterId, limit, models.POST_PUBLISHED)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToPosts(rows)
+}
+
+func mapFromRowsToFollows(rows *sql.Rows) ([]*models.Follow, error) {
+	follows := make([]*models.Follow, 0)
+	for rows.Next() {
+		var follow = models.Follow{}
+		if err := rows.Scan(&follow.UserId, &follow.FollowedAt); err != nil {
+			return nil, err
+		}
+		follows = append(follows, &follow)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return follows, nil
+}
+
+func mapFromRowsToPosts(rows *sql.Rows) ([]*models.Post, error) {
+	var posts []*models.Post
+	for rows.Next() {
+		var post = models.Post{}
+		if err := rows.Scan(postDestinations(&post)...); err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
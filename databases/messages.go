@@ -0,0 +1,184 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func (repo *PostgresRepository) InsertConversation(ctx context.Context, conversation *models.Conversation) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		"INSERT INTO conversations (id, first_user_id, second_user_id) VALUES ($1, $2, $3)",
+		conversation.Id,
+		conversation.FirstUserId,
+		conversation.SecondUserId,
+	)
+	return err
+}
+
+func (repo *PostgresRepository) GetConversationById(ctx context.Context, id string) (*models.Conversation, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, first_user_id, second_user_id, created_at FROM conversations WHERE id = $1",
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToConversation(rows)
+}
+
+func (repo *PostgresRepository) GetConversationByMembers(ctx context.Context, firstUserId, secondUserId string) (*models.Conversation, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, first_user_id, second_user_id, created_at FROM conversations WHERE first_user_id = $1 AND second_user_id = $2",
+		firstUserId,
+		secondUserId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToConversation(rows)
+}
+
+func (repo *PostgresRepository) ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, first_user_id, second_user_id, created_at FROM conversations WHERE first_user_id = $1 OR second_user_id = $1 ORDER BY created_at DESC",
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	conversations := make([]*models.Conversation, 0)
+	for rows.Next() {
+		var conversation = models.Conversation{}
+		if err = rows.Scan(&conversation.Id, &conversation.FirstUserId, &conversation.SecondUserId, &conversation.CreatedAt); err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, &conversation)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return conversations, nil
+}
+
+func (repo *PostgresRepository) InsertMessage(ctx context.Context, message *models.Message) error {
+	return repo.db.QueryRowContext(
+		ctx,
+		"INSERT INTO messages (id, conversation_id, sender_id, recipient_id, content) VALUES ($1, $2, $3, $4, $5) RETURNING created_at",
+		message.Id,
+		message.ConversationId,
+		message.SenderId,
+		message.RecipientId,
+		message.Content,
+	).Scan(&message.CreatedAt)
+}
+
+// ListMessages returns the conversation history newest first, starting
+// after cursor when it is set.
+func (repo *PostgresRepository) ListMessages(ctx context.Context, conversationId string, cursor *models.PostCursor, limit uint64) ([]*models.Message, error) {
+	var before sql.NullTime
+	var beforeId string
+	if cursor != nil {
+		before = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		beforeId = cursor.Id
+	}
+
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT id, conversation_id, sender_id, recipient_id, content, created_at, delivered_at, read_at
+		FROM messages WHERE conversation_id = $1
+		AND ($2::timestamp IS NULL OR (created_at, id) < ($2, $3))
+		ORDER BY created_at DESC, id DESC LIMIT $4`,
+		conversationId,
+		before,
+		beforeId,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	messages := make([]*models.Message, 0)
+	for rows.Next() {
+		var message = models.Message{}
+		var deliveredAt, readAt sql.NullTime
+		if err = rows.Scan(
+			&message.Id,
+			&message.ConversationId,
+			&message.SenderId,
+			&message.RecipientId,
+			&message.Content,
+			&message.CreatedAt,
+			&deliveredAt,
+			&readAt,
+		); err != nil {
+			return nil, err
+		}
+		if deliveredAt.Valid {
+			message.DeliveredAt = &deliveredAt.Time
+		}
+		if readAt.Valid {
+			message.ReadAt = &readAt.Time
+		}
+		messages = append(messages, &message)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (repo *PostgresRepository) MarkMessagesDelivered(ctx context.Context, conversationId, recipientId string, at time.Time) (int64, error) {
+	result, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE messages SET delivered_at = $1 WHERE conversation_id = $2 AND recipient_id = $3 AND delivered_at IS NULL",
+		at,
+		conversationId,
+		recipientId,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// MarkMessagesRead also marks as delivered the messages that were read
+// before a delivery receipt was recorded.
+func (repo *PostgresRepository) MarkMessagesRead(ctx context.Context, conversationId, recipientId string, at time.Time) (int64, error) {
+	result, err := repo.db.ExecContext(
+		ctx,
+		"UPDATE messages SET read_at = $1, delivered_at = COALESCE(delivered_at, $1) WHERE conversation_id = $2 AND recipient_id = $3 AND read_at IS NULL",
+		at,
+		conversationId,
+		recipientId,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func mapFromRowsToConversation(rows *sql.Rows) (*models.Conversation, error) {
+	var conversation *models.Conversation
+	for rows.Next() {
+		conversation = &models.Conversation{}
+		if err := rows.Scan(&conversation.Id, &conversation.FirstUserId, &conversation.SecondUserId, &conversation.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return conversation, nil
+}
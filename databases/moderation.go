@@ -0,0 +1,271 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+)
+
+const (
+	REPORTS_PAGE_SIZE        = 50
+	MODERATION_LOG_PAGE_SIZE = 50
+
+	reportColumns = `id, post_id, COALESCE(reporter_id, ''), reason, status, created_at,
+	resolved_at, COALESCE(resolved_by, '')`
+)
+
+func reportDestinations(report *models.Report) []interface{} {
+	return []interface{}{
+		&report.Id,
+		&report.PostId,
+		&report.ReporterId,
+		&report.Reason,
+		&report.Status,
+		&report.CreatedAt,
+		&report.ResolvedAt,
+		&report.ResolvedBy,
+	}
+}
+
+func nullable(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
+// execer is what logModeration needs from either the database or a
+// transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func logModeration(ctx context.Context, db execer, entry *models.ModerationLogEntry) error {
+	_, err := db.ExecContext(
+		ctx,
+		`INSERT INTO moderation_log (actor_id, action, user_id, post_id, report_id, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		nullable(entry.ActorId),
+		entry.Action,
+		nullable(entry.UserId),
+		nullable(entry.PostId),
+		nullable(entry.ReportId),
+		entry.Reason,
+	)
+	return err
+}
+
+func (repo *PostgresRepository) InsertModerationLog(ctx context.Context, entry *models.ModerationLogEntry) error {
+	return logModeration(ctx, repo.db, entry)
+}
+
+// InsertReport files the report and hides the post once hideAfter users
+// have reported it. A reporter, the filters included, has at most one open
+// report on a post; another one is repository.ErrAlreadyReported.
+func (repo *PostgresRepository) InsertReport(ctx context.Context, report *models.Report, hideAfter int) (bool, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	report.Status = models.REPORT_OPEN
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO reports (id, post_id, reporter_id, reason, status) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (post_id, COALESCE(reporter_id, '')) WHERE status = 'open' DO NOTHING
+		RETURNING created_at`,
+		report.Id,
+		report.PostId,
+		nullable(report.ReporterId),
+		report.Reason,
+		report.Status,
+	).Scan(&report.CreatedAt)
+	if err == sql.ErrNoRows {
+		return false, repository.ErrAlreadyReported
+	}
+	if err != nil {
+		return false, err
+	}
+
+	var authorId string
+	if err := tx.QueryRowContext(ctx, "SELECT user_id FROM posts WHERE id = $1", report.PostId).Scan(&authorId); err != nil {
+		return false, err
+	}
+	action := models.MODERATION_REPORTED
+	if report.ReporterId == "" {
+		action = models.MODERATION_FLAGGED
+	}
+	if err := logModeration(ctx, tx, &models.ModerationLogEntry{
+		ActorId:  report.ReporterId,
+		Action:   action,
+		UserId:   authorId,
+		PostId:   report.PostId,
+		ReportId: report.Id,
+		Reason:   report.Reason,
+	}); err != nil {
+		return false, err
+	}
+
+	hidden := false
+	if report.ReporterId != "" {
+		result, err := tx.ExecContext(
+			ctx,
+			`UPDATE posts SET hidden_at = NOW() WHERE id = $1 AND hidden_at IS NULL AND (
+				SELECT COUNT(*) FROM reports WHERE post_id = $1 AND status = $2 AND reporter_id IS NOT NULL
+			) >= $3`,
+			report.PostId,
+			models.REPORT_OPEN,
+			hideAfter,
+		)
+		if err != nil {
+			return false, err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return false, err
+		}
+		if hidden = affected > 0; hidden {
+			if err := logModeration(ctx, tx, &models.ModerationLogEntry{
+				Action: models.MODERATION_HIDDEN,
+				UserId: authorId,
+				PostId: report.PostId,
+				Reason: "reported by too many users",
+			}); err != nil {
+				return false, err
+			}
+		}
+	}
+	return hidden, tx.Commit()
+}
+
+// ListReports returns the reports with the given status, newest first.
+func (repo *PostgresRepository) ListReports(ctx context.Context, status string, page uint64) ([]*models.Report, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+reportColumns+" FROM reports WHERE status = $1 ORDER BY created_at DESC, id DESC LIMIT $2 OFFSET $3",
+		status,
+		REPORTS_PAGE_SIZE,
+		page*REPORTS_PAGE_SIZE,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	reports := make([]*models.Report, 0)
+	for rows.Next() {
+		var report = models.Report{}
+		if err = rows.Scan(reportDestinations(&report)...); err != nil {
+			return nil, err
+		}
+		reports = append(reports, &report)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return reports, nil
+}
+
+// CloseReport resolves or dismisses, as report.Status says, every open
+// report on the post of the report. Resolving hides the post and dismissing
+// shows it again. It returns repository.ErrNotFound when the report is not
+// open.
+func (repo *PostgresRepository) CloseReport(ctx context.Context, report *models.Report) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status, resolvedBy := report.Status, report.ResolvedBy
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT "+reportColumns+" FROM reports WHERE id = $1 AND status = $2 FOR UPDATE",
+		report.Id,
+		models.REPORT_OPEN,
+	).Scan(reportDestinations(report)...)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// NOW() is the start of the transaction, the same for every row
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE reports SET status = $3, resolved_at = NOW(), resolved_by = $4
+		WHERE post_id = $1 AND status = $2 RETURNING resolved_at`,
+		report.PostId,
+		models.REPORT_OPEN,
+		status,
+		resolvedBy,
+	).Scan(&report.ResolvedAt)
+	if err != nil {
+		return err
+	}
+	report.Status, report.ResolvedBy = status, resolvedBy
+
+	hiddenAt := "COALESCE(hidden_at, NOW())"
+	action := models.MODERATION_RESOLVED
+	if status == models.REPORT_DISMISSED {
+		hiddenAt = "NULL"
+		action = models.MODERATION_DISMISSED
+	}
+	var authorId string
+	if err := tx.QueryRowContext(
+		ctx,
+		"UPDATE posts SET hidden_at = "+hiddenAt+" WHERE id = $1 RETURNING user_id",
+		report.PostId,
+	).Scan(&authorId); err != nil {
+		return err
+	}
+	if err := logModeration(ctx, tx, &models.ModerationLogEntry{
+		ActorId:  resolvedBy,
+		Action:   action,
+		UserId:   authorId,
+		PostId:   report.PostId,
+		ReportId: report.Id,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListModerationLog returns the moderation actions, newest first.
+func (repo *PostgresRepository) ListModerationLog(ctx context.Context, page uint64) ([]*models.ModerationLogEntry, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT id, COALESCE(actor_id, ''), action, COALESCE(user_id, ''), COALESCE(post_id, ''),
+		COALESCE(report_id, ''), reason, created_at
+		FROM moderation_log ORDER BY id DESC LIMIT $1 OFFSET $2`,
+		MODERATION_LOG_PAGE_SIZE,
+		page*MODERATION_LOG_PAGE_SIZE,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	entries := make([]*models.ModerationLogEntry, 0)
+	for rows.Next() {
+		var entry = models.ModerationLogEntry{}
+		if err = rows.Scan(
+			&entry.Id,
+			&entry.ActorId,
+			&entry.Action,
+			&entry.UserId,
+			&entry.PostId,
+			&entry.ReportId,
+			&entry.Reason,
+			&entry.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
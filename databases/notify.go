@@ -0,0 +1,232 @@
+package databases
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	HUB_CHANNEL = "hub_events"
+	// postgres rejects NOTIFY payloads of 8000 bytes or more
+	MAX_NOTIFY_PAYLOAD = 7999
+	// advisory lock held while numbering a hub event, so the events are
+	// committed in the order of their ids
+	HUB_EVENT_LOCK = 0x687562
+	// how long hub events are kept for instances catching up after their
+	// listener reconnected
+	HUB_EVENT_RETENTION      = 10 * time.Minute
+	HUB_EVENT_PRUNE_INTERVAL = time.Minute
+)
+
+var ErrPayloadTooLarge = errors.New("payload too large for NOTIFY")
+
+// PostgresBackplane relays hub messages between server instances using
+// LISTEN/NOTIFY on the application database.
+//
+// Sequenced payloads are stored in hub_events, whose id is the event id, and
+// the notification only carries that id; every instance reads the events
+// after the last one it saw, so it neither depends on the size of a payload
+// nor misses the events notified while its listener was reconnecting.
+// Unsequenced payloads travel in the notification itself after "0:".
+type PostgresBackplane struct {
+	db       *sql.DB
+	listener *pq.Listener
+	handlers []func(id uint64, payload []byte)
+	onGaps   []func()
+	lock     *sync.RWMutex
+	// only used by the listen goroutine
+	lastId      uint64
+	reconnected bool
+	done        chan struct{}
+}
+
+func NewPostgresBackplane(url string) (*PostgresBackplane, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	listener := pq.NewListener(url, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("backplane listener:", err)
+		}
+	})
+	if err := listener.Listen(HUB_CHANNEL); err != nil {
+		db.Close()
+		listener.Close()
+		return nil, err
+	}
+
+	backplane := &PostgresBackplane{
+		db:       db,
+		listener: listener,
+		handlers: make([]func(id uint64, payload []byte), 0),
+		onGaps:   make([]func(), 0),
+		lock:     &sync.RWMutex{},
+		done:     make(chan struct{}),
+	}
+	// listening already, so nothing committed from here on is missed
+	if err := db.QueryRow("SELECT COALESCE(MAX(id), 0) FROM hub_events").Scan(&backplane.lastId); err != nil {
+		db.Close()
+		listener.Close()
+		return nil, err
+	}
+	go backplane.listen()
+	go backplane.prune()
+	return backplane, nil
+}
+
+func (b *PostgresBackplane) listen() {
+	for notification := range b.listener.Notify {
+		// a nil notification means the connection was re-established and
+		// anything notified in between was lost; the stored events are
+		// read back, the others are gone
+		if notification == nil {
+			b.reconnected = true
+			b.catchUp()
+			continue
+		}
+		if value, payload, ok := strings.Cut(notification.Extra, ":"); ok && value == "0" {
+			b.lock.RLock()
+			for _, handler := range b.handlers {
+				handler(0, []byte(payload))
+			}
+			b.lock.RUnlock()
+			continue
+		}
+		b.catchUp()
+	}
+}
+
+// catchUp hands the events stored after lastId to the handlers. Failures are
+// retried on the next notification. After a reconnection, the handlers are
+// told about a gap when events after lastId were already pruned.
+func (b *PostgresBackplane) catchUp() {
+	if b.reconnected {
+		var gap sql.NullBool
+		err := b.db.QueryRow(
+			`SELECT (SELECT MIN(id) FROM hub_events WHERE id > $1) > $1 + 1
+			AND NOT EXISTS (SELECT 1 FROM hub_events WHERE id <= $1)`,
+			b.lastId,
+		).Scan(&gap)
+		if err != nil {
+			log.Println("backplane:", err)
+			return
+		}
+		b.reconnected = false
+		if gap.Bool {
+			b.lock.RLock()
+			for _, onGap := range b.onGaps {
+				onGap()
+			}
+			b.lock.RUnlock()
+		}
+	}
+
+	rows, err := b.db.Query("SELECT id, payload FROM hub_events WHERE id > $1 ORDER BY id", b.lastId)
+	if err != nil {
+		log.Println("backplane:", err)
+		return
+	}
+	defer handleCloseCursor(rows)
+	for rows.Next() {
+		var id uint64
+		var payload []byte
+		if err := rows.Scan(&id, &payload); err != nil {
+			log.Println("backplane:", err)
+			return
+		}
+		b.lastId = id
+		b.lock.RLock()
+		for _, handler := range b.handlers {
+			handler(id, payload)
+		}
+		b.lock.RUnlock()
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("backplane:", err)
+	}
+}
+
+// prune removes the events older than HUB_EVENT_RETENTION, except the most
+// recent one, which tells reconnecting instances whether they missed any.
+func (b *PostgresBackplane) prune() {
+	ticker := time.NewTicker(HUB_EVENT_PRUNE_INTERVAL)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		}
+		_, err := b.db.Exec(
+			`DELETE FROM hub_events WHERE created_at < NOW() - $1::interval
+			AND id < (SELECT MAX(id) FROM hub_events)`,
+			interval(HUB_EVENT_RETENTION),
+		)
+		if err != nil {
+			log.Println("backplane:", err)
+		}
+	}
+}
+
+// Publish stores a sequenced payload in hub_events. The lock is held until
+// the commit, so no instance can read an event before the ones numbered
+// ahead of it.
+func (b *PostgresBackplane) Publish(payload []byte, sequenced bool) error {
+	if !sequenced {
+		return notify(b.db, "0:"+string(payload))
+	}
+
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SELECT pg_advisory_xact_lock($1)", HUB_EVENT_LOCK); err != nil {
+		return err
+	}
+	var id uint64
+	if err := tx.QueryRow("INSERT INTO hub_events (payload) VALUES ($1) RETURNING id", payload).Scan(&id); err != nil {
+		return err
+	}
+	if err := notify(tx, strconv.FormatUint(id, 10)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// notify sends extra on HUB_CHANNEL; within a transaction it is only sent
+// on commit.
+func notify(db interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}, extra string) error {
+	if len(extra) > MAX_NOTIFY_PAYLOAD {
+		return ErrPayloadTooLarge
+	}
+	_, err := db.Exec("SELECT pg_notify($1, $2)", HUB_CHANNEL, extra)
+	return err
+}
+
+func (b *PostgresBackplane) Subscribe(handler func(id uint64, payload []byte), onGap func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.handlers = append(b.handlers, handler)
+	b.onGaps = append(b.onGaps, onGap)
+}
+
+func (b *PostgresBackplane) Close() error {
+	close(b.done)
+	if err := b.listener.Close(); err != nil {
+		return err
+	}
+	return b.db.Close()
+}
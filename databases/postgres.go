@@ -3,14 +3,25 @@ package databases
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"strings"
 
 	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
 	_ "github.com/lib/pq"
 )
 
+// postColumns are the columns of a post read by postDestinations, selected
+// from the posts table without an alias. The comment count is the raw one;
+// it is narrowed to what a viewer can see with GetCommentCounts.
+const postColumns = `posts.id, posts.user_id, posts.post_content, posts.format, posts.post_html, posts.created_at,
+	posts.updated_at, posts.updated_at IS NOT NULL, posts.status, posts.publish_at, posts.visibility, posts.deleted_at, posts.hidden_at,
+	(SELECT COUNT(*) FROM comments WHERE comments.post_id = posts.id)`
+
 type PostgresRepository struct {
-	db *sql.DB
+	db               *sql.DB
+	timelineStrategy string
 }
 
 func NewPostgresRepository(url string) (*PostgresRepository, error) {
@@ -18,16 +29,17 @@ func NewPostgresRepository(url string) (*PostgresRepository, error) {
 	if error != nil {
 		return nil, error
 	}
-	return &PostgresRepository{db}, nil
+	return &PostgresRepository{db: db, timelineStrategy: TIMELINE_FAN_OUT_ON_READ}, nil
 }
 
 func (repo *PostgresRepository) InsertUser(ctx context.Context, user *models.User) error {
 	_, error := repo.db.ExecContext(
 		ctx,
-		"INSERT INTO users (id, email, password) VALUES ($1, $2, $3)",
+		"INSERT INTO users (id, email, password, handle) VALUES ($1, $2, $3, $4)",
 		user.Id,
 		user.Email,
 		user.Password,
+		sql.NullString{String: user.Handle, Valid: user.Handle != ""},
 	)
 	return error
 }
@@ -35,7 +47,7 @@ func (repo *PostgresRepository) InsertUser(ctx context.Context, user *models.Use
 func (repo *PostgresRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	rows, err := repo.db.QueryContext(
 		ctx,
-		"SELECT id, email, password FROM users WHERE email = $1",
+		"SELECT id, email, password, handle FROM users WHERE email = $1",
 		email,
 	)
 	defer handleCloseCursor(rows)
@@ -48,7 +60,7 @@ func (repo *PostgresRepository) GetUserByEmail(ctx context.Context, email string
 func (repo *PostgresRepository) GetUserById(ctx context.Context, id string) (*models.User, error) {
 	rows, err := repo.db.QueryContext(
 		ctx,
-		"SELECT id, email, password FROM users WHERE id = $1",
+		"SELECT id, email, password, handle FROM users WHERE id = $1",
 		id,
 	)
 	defer handleCloseCursor(rows)
@@ -63,20 +75,162 @@ func (repo *PostgresRepository) Close() error {
 }
 
 func (repo *PostgresRepository) InsertPost(ctx context.Context, post *models.Post) error {
-	_, err := repo.db.ExecContext(
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if post.Status == "" {
+		post.Status = models.POST_PUBLISHED
+	}
+	if post.Visibility == "" {
+		post.Visibility = models.VISIBILITY_PUBLIC
+	}
+	if post.Format == "" {
+		post.Format = models.POST_FORMAT_PLAIN
+	}
+	err = tx.QueryRowContext(
+		ctx,
+		`INSERT INTO posts (id, post_content, format, post_html, user_id, status, publish_at, visibility)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING created_at`,
+		post.Id,
+		post.PostContent,
+		post.Format,
+		post.PostHTML,
+		post.UserId,
+		post.Status,
+		post.PublishAt,
+		post.Visibility,
+	).Scan(&post.CreatedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(
 		ctx,
-		"INSERT INTO posts (id, post_content, user_id) VALUES ($1, $2, $3)",
+		"INSERT INTO post_revisions (post_id, revision, post_content, format, created_at) VALUES ($1, 1, $2, $3, $4)",
 		post.Id,
 		post.PostContent,
+		post.Format,
+		post.CreatedAt,
+	); err != nil {
+		return err
+	}
+
+	if post.Status == models.POST_PUBLISHED {
+		if err := repo.fanOut(ctx, tx, post); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// fanOut copies a newly published post to the timelines of the followers of
+// its author when timelines are built on write.
+func (repo *PostgresRepository) fanOut(ctx context.Context, tx *sql.Tx, post *models.Post) error {
+	if repo.timelineStrategy != TIMELINE_FAN_OUT_ON_WRITE {
+		return nil
+	}
+	_, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO timeline_entries (user_id, post_id, author_id, created_at)
+		SELECT follower_id, $1, $2, $3 FROM follows WHERE followed_id = $2`,
+		post.Id,
 		post.UserId,
+		post.CreatedAt,
 	)
 	return err
 }
 
+// SetPostStatus moves a draft or scheduled post of userId to post.Status.
+// Publishing dates the post from now, so it shows up at the top of the
+// listings. Published posts cannot change status anymore.
+func (repo *PostgresRepository) SetPostStatus(ctx context.Context, post *models.Post) error {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	err = tx.QueryRowContext(
+		ctx,
+		"SELECT status FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE",
+		post.Id,
+		post.UserId,
+	).Scan(&current)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if current == models.POST_PUBLISHED {
+		return repository.ErrAlreadyPublished
+	}
+
+	statement := "UPDATE posts SET status = $2, publish_at = $3 WHERE id = $1 RETURNING " + postColumns
+	if post.Status == models.POST_PUBLISHED {
+		statement = "UPDATE posts SET status = $2, publish_at = $3, created_at = NOW() WHERE id = $1 RETURNING " + postColumns
+	}
+	err = tx.QueryRowContext(ctx, statement, post.Id, post.Status, post.PublishAt).Scan(postDestinations(post)...)
+	if err != nil {
+		return err
+	}
+	if post.Status == models.POST_PUBLISHED {
+		if err := repo.fanOut(ctx, tx, post); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// PublishDuePosts publishes up to limit scheduled posts whose time has come.
+// Rows locked by another replica are skipped, so each post is published by
+// exactly one of them.
+func (repo *PostgresRepository) PublishDuePosts(ctx context.Context, limit int) ([]*models.Post, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`UPDATE posts SET status = $1, created_at = NOW()
+		WHERE id IN (
+			SELECT id FROM posts WHERE status = $2 AND publish_at <= NOW() AND deleted_at IS NULL
+			ORDER BY publish_at LIMIT $3 FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+postColumns,
+		models.POST_PUBLISHED,
+		models.POST_SCHEDULED,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := mapFromRowsToPosts(rows)
+	handleCloseCursor(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, post := range posts {
+		if err := repo.fanOut(ctx, tx, post); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
 func (repo *PostgresRepository) GetPostById(ctx context.Context, id string) (*models.Post, error) {
 	rows, err := repo.db.QueryContext(
 		ctx,
-		"SELECT id, user_id, post_content, created_at FROM posts WHERE id = $1",
+		"SELECT "+postColumns+" FROM posts WHERE id = $1 AND deleted_at IS NULL",
 		id,
 	)
 	defer handleCloseCursor(rows)
@@ -86,58 +240,207 @@ func (repo *PostgresRepository) GetPostById(ctx context.Context, id string) (*mo
 	return mapFromRowsToPost(rows)
 }
 
+// UpdatePost records the new content as the next revision of the post. It
+// returns repository.ErrNotFound when userId does not own a post with that
+// id. Saving the content and format the post already has changes nothing,
+// and drafts are not marked edited until they are published. The caller
+// renders PostHTML.
 func (repo *PostgresRepository) UpdatePost(ctx context.Context, post *models.Post) error {
-	_, err := repo.db.ExecContext(
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current, currentFormat string
+	err = tx.QueryRowContext(
 		ctx,
-		"UPDATE posts SET post_content = $1 WHERE id = $2 AND user_id = $3",
-		post.PostContent,
+		`SELECT post_content, format, created_at, updated_at, status, publish_at, visibility
+		FROM posts WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL FOR UPDATE`,
 		post.Id,
 		post.UserId,
-	)
-	return err
+	).Scan(&current, &currentFormat, &post.CreatedAt, &post.UpdatedAt, &post.Status, &post.PublishAt, &post.Visibility)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	post.Edited = post.UpdatedAt != nil
+	if current == post.PostContent && currentFormat == post.Format {
+		return nil
+	}
 
+	// posts written before revisions were kept get their original content
+	// recorded first
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO post_revisions (post_id, revision, post_content, format, created_at)
+		VALUES ($1, 1, $2, $3, $4) ON CONFLICT DO NOTHING`,
+		post.Id,
+		current,
+		currentFormat,
+		post.CreatedAt,
+	); err != nil {
+		return err
+	}
+	err = tx.QueryRowContext(
+		ctx,
+		`UPDATE posts SET post_content = $2, format = $3, post_html = $4,
+		updated_at = CASE WHEN status = $5 THEN NOW() ELSE updated_at END
+		WHERE id = $1 RETURNING updated_at`,
+		post.Id,
+		post.PostContent,
+		post.Format,
+		post.PostHTML,
+		models.POST_PUBLISHED,
+	).Scan(&post.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO post_revisions (post_id, revision, post_content, format, created_at)
+		SELECT $1, MAX(revision) + 1, $2, $3, NOW() FROM post_revisions WHERE post_id = $1`,
+		post.Id,
+		post.PostContent,
+		post.Format,
+	); err != nil {
+		return err
+	}
+	post.Edited = post.UpdatedAt != nil
+	return tx.Commit()
 }
 
+// DeletePost moves a post of userId to the trash. It returns
+// repository.ErrNotFound when there is no such post outside the trash.
 func (repo *PostgresRepository) DeletePost(ctx context.Context, id, userId string) error {
-	_, err := repo.db.ExecContext(
+	result, err := repo.db.ExecContext(
 		ctx,
-		"DELETE FROM posts WHERE id = $1 AND user_id = $2",
+		"UPDATE posts SET deleted_at = NOW() WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL",
 		id,
 		userId,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
 }
 
-func (repo *PostgresRepository) ListPost(ctx context.Context, page uint64) ([]*models.Post, error) {
-	rows, err := repo.db.QueryContext(
-		ctx,
-		"SELECT id, post_content, user_id, created_at FROM posts LIMIT $1 OFFSET $2",
-		2,
-		page*2,
-	)
+const (
+	LEGACY_PAGE_SIZE = 2
+)
 
-	if err != nil {
-		return nil, err
+// ListPost returns the page of posts described by query. Backward cursors
+// fetch the posts right before the cursor, still returned in query order.
+func (repo *PostgresRepository) ListPost(ctx context.Context, query *models.PostQuery) ([]*models.Post, error) {
+	var conditions []string
+	var args []interface{}
+	arg := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
 	}
-	defer handleCloseCursor(rows)
 
-	var posts []*models.Post
+	status := query.Status
+	if status == "" {
+		status = models.POST_PUBLISHED
+	}
+	conditions = append(conditions, "status = "+arg(status))
+	viewer := arg(query.ViewerId)
+	conditions = append(conditions, visibleTo(viewer, query.UserId == ""))
+	if query.UserId != "" {
+		conditions = append(conditions, "user_id = "+arg(query.UserId))
+	} else {
+		// the posts of a muted user are still shown on their own page
+		conditions = append(conditions, notMuted(viewer, "posts.user_id"))
+	}
+	if query.Tag != "" {
+		conditions = append(conditions, "id IN (SELECT post_id FROM post_tags WHERE tag = "+arg(query.Tag)+")")
+	}
+	if query.CreatedAfter != nil {
+		conditions = append(conditions, "created_at > "+arg(*query.CreatedAfter))
+	}
+	if query.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < "+arg(*query.CreatedBefore))
+	}
+	if query.Contains != "" {
+		conditions = append(conditions, "post_content ILIKE '%' || "+arg(escapeLike(query.Contains))+" || '%'")
+	}
 
-	for rows.Next() {
-		var post = models.Post{}
+	// the scan runs against the requested order when paging backward
+	descending := query.Ascending == (query.Cursor != nil && query.Cursor.Backward)
+	if query.Cursor != nil {
+		comparison := ">"
+		if descending {
+			comparison = "<"
+		}
+		conditions = append(conditions, fmt.Sprintf(
+			"(created_at, id) %s (%s, %s)",
+			comparison,
+			arg(query.Cursor.CreatedAt),
+			arg(query.Cursor.Id),
+		))
+	}
 
-		if err = rows.Scan(&post.Id, &post.UserId, &post.PostContent, &post.CreatedAt); err == nil {
-			posts = append(posts, &post)
-		} 
+	statement := "SELECT " + postColumns + " FROM posts"
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if descending {
+		statement += " ORDER BY created_at DESC, id DESC"
+	} else {
+		statement += " ORDER BY created_at ASC, id ASC"
 	}
+	statement += " LIMIT " + arg(query.Limit)
 
-	if err = rows.Err(); err != nil {
+	rows, err := repo.db.QueryContext(ctx, statement, args...)
+	if err != nil {
 		return nil, err
 	}
+	defer handleCloseCursor(rows)
 
+	posts, err := mapFromRowsToPosts(rows)
+	if err != nil {
+		return nil, err
+	}
+	if query.Cursor != nil && query.Cursor.Backward {
+		for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+			posts[i], posts[j] = posts[j], posts[i]
+		}
+	}
 	return posts, nil
 }
 
+func escapeLike(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+}
+
+// ListPostPage serves the deprecated offset pagination, with the posts
+// viewerId may see as ListPost does.
+func (repo *PostgresRepository) ListPostPage(ctx context.Context, page uint64, viewerId string) ([]*models.Post, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+postColumns+" FROM posts WHERE status = $3 AND "+visibleTo("$4", true)+" AND "+notMuted("$4", "posts.user_id")+
+			" ORDER BY created_at DESC, id DESC LIMIT $1 OFFSET $2",
+		LEGACY_PAGE_SIZE,
+		page*LEGACY_PAGE_SIZE,
+		models.POST_PUBLISHED,
+		viewerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToPosts(rows)
+}
+
 func handleCloseCursor(rows *sql.Rows) {
 	err := rows.Close()
 	if err != nil {
@@ -148,9 +451,11 @@ func handleCloseCursor(rows *sql.Rows) {
 func mapFromRowsToUser(rows *sql.Rows) (*models.User, error) {
 	user := models.User{}
 	for rows.Next() {
-		if err := rows.Scan(&user.Id, &user.Email, &user.Password); err != nil {
+		var handle sql.NullString
+		if err := rows.Scan(&user.Id, &user.Email, &user.Password, &handle); err != nil {
 			return nil, err
 		}
+		user.Handle = handle.String
 	}
 	if err := rows.Err(); err != nil {
 		return nil, err
@@ -158,10 +463,30 @@ func mapFromRowsToUser(rows *sql.Rows) (*models.User, error) {
 	return &user, nil
 }
 
+// postDestinations are where the postColumns of a row are scanned to.
+func postDestinations(post *models.Post) []interface{} {
+	return []interface{}{
+		&post.Id,
+		&post.UserId,
+		&post.PostContent,
+		&post.Format,
+		&post.PostHTML,
+		&post.CreatedAt,
+		&post.UpdatedAt,
+		&post.Edited,
+		&post.Status,
+		&post.PublishAt,
+		&post.Visibility,
+		&post.DeletedAt,
+		&post.HiddenAt,
+		&post.CommentCount,
+	}
+}
+
 func mapFromRowsToPost(rows *sql.Rows) (*models.Post, error) {
 	post := models.Post{}
 	for rows.Next() {
-		if err := rows.Scan(&post.Id, &post.UserId, &post.PostContent, &post.CreatedAt); err != nil {
+		if err := rows.Scan(postDestinations(&post)...); err != nil {
 			return nil, err
 		}
 	}
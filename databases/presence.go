@@ -0,0 +1,123 @@
+package databases
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+const (
+	// entries of a hub that has not refreshed them for this long belong to
+	// an instance that is gone; several times websockets.PRESENCE_HEARTBEAT
+	PRESENCE_EXPIRY = time.Minute
+)
+
+// PostgresPresence shares the connections of the users between server
+// instances, one hub_presence row per hub and user.
+type PostgresPresence struct {
+	db *sql.DB
+}
+
+func NewPostgresPresence(url string) (*PostgresPresence, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresPresence{db: db}, nil
+}
+
+func (p *PostgresPresence) Connect(hubId string, userId string) (bool, error) {
+	var first bool
+	// the subquery sees the table as it was before the insert
+	err := p.db.QueryRow(
+		`INSERT INTO hub_presence (hub_id, user_id, connections) VALUES ($1, $2, 1)
+		ON CONFLICT (hub_id, user_id) DO UPDATE SET connections = hub_presence.connections + 1
+		RETURNING NOT EXISTS (SELECT 1 FROM hub_presence WHERE user_id = $2)`,
+		hubId,
+		userId,
+	).Scan(&first)
+	return first, err
+}
+
+func (p *PostgresPresence) Disconnect(hubId string, userId string) error {
+	_, err := p.db.Exec(
+		`UPDATE hub_presence SET connections = connections - 1
+		WHERE hub_id = $1 AND user_id = $2 AND connections > 0`,
+		hubId,
+		userId,
+	)
+	return err
+}
+
+func (p *PostgresPresence) Forget(hubId string, userId string) (bool, error) {
+	var gone bool
+	err := p.db.QueryRow(
+		`WITH forgotten AS (
+			DELETE FROM hub_presence WHERE hub_id = $1 AND user_id = $2 AND connections = 0
+		)
+		SELECT NOT EXISTS (SELECT 1 FROM hub_presence WHERE user_id = $2 AND hub_id <> $1)`,
+		hubId,
+		userId,
+	).Scan(&gone)
+	return gone, err
+}
+
+func (p *PostgresPresence) Expire(hubId string) ([]string, error) {
+	if _, err := p.db.Exec("UPDATE hub_presence SET seen_at = NOW() WHERE hub_id = $1", hubId); err != nil {
+		return nil, err
+	}
+
+	// the outer query sees the expired rows too, hence the seen_at condition
+	rows, err := p.db.Query(
+		`WITH expired AS (
+			DELETE FROM hub_presence WHERE seen_at < NOW() - $1::interval RETURNING user_id
+		)
+		SELECT DISTINCT user_id FROM expired WHERE NOT EXISTS (
+			SELECT 1 FROM hub_presence
+			WHERE hub_presence.user_id = expired.user_id AND seen_at >= NOW() - $1::interval
+		)`,
+		interval(PRESENCE_EXPIRY),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	users := make([]string, 0)
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			return nil, err
+		}
+		users = append(users, userId)
+	}
+	return users, rows.Err()
+}
+
+func (p *PostgresPresence) Online() ([]models.OnlineUser, error) {
+	rows, err := p.db.Query(
+		`SELECT user_id, SUM(connections) FROM hub_presence
+		WHERE seen_at >= NOW() - $1::interval
+		GROUP BY user_id ORDER BY user_id`,
+		interval(PRESENCE_EXPIRY),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	users := make([]models.OnlineUser, 0)
+	for rows.Next() {
+		var user models.OnlineUser
+		if err := rows.Scan(&user.UserId, &user.Connections); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (p *PostgresPresence) Close() error {
+	return p.db.Close()
+}
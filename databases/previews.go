@@ -0,0 +1,144 @@
+package databases
+
+import (
+	"context"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/lib/pq"
+)
+
+const linkPreviewColumns = "link_previews.url, title, description, image_url, site_name, fetched_at"
+
+// linkPreviewDestinations returns where to scan linkPreviewColumns.
+func linkPreviewDestinations(preview *models.LinkPreview) []interface{} {
+	return []interface{}{
+		&preview.URL,
+		&preview.Title,
+		&preview.Description,
+		&preview.ImageURL,
+		&preview.SiteName,
+		&preview.FetchedAt,
+	}
+}
+
+// GetLinkPreviews returns the cached previews of urls, stale ones included.
+func (repo *PostgresRepository) GetLinkPreviews(ctx context.Context, urls []string) (map[string]*models.LinkPreview, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+linkPreviewColumns+" FROM link_previews WHERE url = ANY($1)",
+		pq.Array(urls),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	previews := make(map[string]*models.LinkPreview)
+	for rows.Next() {
+		var preview = models.LinkPreview{}
+		if err = rows.Scan(linkPreviewDestinations(&preview)...); err != nil {
+			return nil, err
+		}
+		previews[preview.URL] = &preview
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return previews, nil
+}
+
+func (repo *PostgresRepository) SaveLinkPreview(ctx context.Context, preview *models.LinkPreview) error {
+	_, err := repo.db.ExecContext(
+		ctx,
+		`INSERT INTO link_previews (url, title, description, image_url, site_name, fetched_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (url) DO UPDATE SET title = EXCLUDED.title, description = EXCLUDED.description,
+		image_url = EXCLUDED.image_url, site_name = EXCLUDED.site_name, fetched_at = EXCLUDED.fetched_at`,
+		preview.URL,
+		preview.Title,
+		preview.Description,
+		preview.ImageURL,
+		preview.SiteName,
+		preview.FetchedAt,
+	)
+	return err
+}
+
+// ReplacePostPreviews makes urls, in that order, the previews of the post.
+// It tells whether anything changed.
+func (repo *PostgresRepository) ReplacePostPreviews(ctx context.Context, postId string, urls []string) (bool, error) {
+	if urls == nil {
+		// a nil array is NULL, which would keep every preview
+		urls = []string{}
+	}
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	deleted, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM post_link_previews WHERE post_id = $1 AND NOT (url = ANY($2))",
+		postId,
+		pq.Array(urls),
+	)
+	if err != nil {
+		return false, err
+	}
+	upserted, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO post_link_previews (post_id, url, position)
+		SELECT $1, url, position FROM unnest($2::TEXT[]) WITH ORDINALITY AS links (url, position)
+		ON CONFLICT (post_id, url) DO UPDATE SET position = EXCLUDED.position
+		WHERE post_link_previews.position <> EXCLUDED.position`,
+		postId,
+		pq.Array(urls),
+	)
+	if err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+
+	deletedCount, err := deleted.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	upsertedCount, err := upserted.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deletedCount+upsertedCount > 0, nil
+}
+
+func (repo *PostgresRepository) ListPostPreviews(ctx context.Context, postIds []string) (map[string][]*models.LinkPreview, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT post_link_previews.post_id, `+linkPreviewColumns+`
+		FROM post_link_previews JOIN link_previews ON link_previews.url = post_link_previews.url
+		WHERE post_link_previews.post_id = ANY($1)
+		ORDER BY post_link_previews.position`,
+		pq.Array(postIds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	previews := make(map[string][]*models.LinkPreview)
+	for rows.Next() {
+		var postId string
+		var preview = models.LinkPreview{}
+		destinations := append([]interface{}{&postId}, linkPreviewDestinations(&preview)...)
+		if err = rows.Scan(destinations...); err != nil {
+			return nil, err
+		}
+		previews[postId] = append(previews[postId], &preview)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return previews, nil
+}
@@ -0,0 +1,113 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/lib/pq"
+)
+
+// AddReaction records the reaction once per user and kind. It reports
+// whether anything changed, so repeating it leaves the counters alone.
+func (repo *PostgresRepository) AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	return repo.changeReaction(
+		ctx,
+		reaction,
+		"INSERT INTO reactions (post_id, user_id, kind) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING",
+		`INSERT INTO post_reaction_counts (post_id, kind, count) VALUES ($1, $2, 1)
+		ON CONFLICT (post_id, kind) DO UPDATE SET count = post_reaction_counts.count + 1`,
+	)
+}
+
+func (repo *PostgresRepository) RemoveReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	return repo.changeReaction(
+		ctx,
+		reaction,
+		"DELETE FROM reactions WHERE post_id = $1 AND user_id = $2 AND kind = $3",
+		"UPDATE post_reaction_counts SET count = count - 1 WHERE post_id = $1 AND kind = $2",
+	)
+}
+
+// changeReaction runs the reaction change and, only when it affected a row,
+// the counter update in the same transaction. The row lock taken on the
+// counter serializes concurrent reactions to the same post and kind.
+func (repo *PostgresRepository) changeReaction(ctx context.Context, reaction *models.Reaction, change string, count string) (bool, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, change, reaction.PostId, reaction.UserId, reaction.Kind)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return false, err
+	}
+
+	if _, err := tx.ExecContext(ctx, count, reaction.PostId, reaction.Kind); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+func (repo *PostgresRepository) GetReactionCounts(ctx context.Context, postIds []string) (map[string]map[string]uint64, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT post_id, kind, count FROM post_reaction_counts WHERE post_id = ANY($1) AND count > 0",
+		pq.Array(postIds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	counts := make(map[string]map[string]uint64)
+	for rows.Next() {
+		var postId, kind string
+		var count uint64
+		if err = rows.Scan(&postId, &kind, &count); err != nil {
+			return nil, err
+		}
+		if counts[postId] == nil {
+			counts[postId] = make(map[string]uint64)
+		}
+		counts[postId][kind] = count
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+func (repo *PostgresRepository) GetUserReactions(ctx context.Context, postIds []string, userId string) (map[string][]string, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT post_id, kind FROM reactions WHERE post_id = ANY($1) AND user_id = $2 ORDER BY created_at",
+		pq.Array(postIds),
+		userId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToKinds(rows)
+}
+
+func mapFromRowsToKinds(rows *sql.Rows) (map[string][]string, error) {
+	kinds := make(map[string][]string)
+	for rows.Next() {
+		var postId, kind string
+		if err := rows.Scan(&postId, &kind); err != nil {
+			return nil, err
+		}
+		kinds[postId] = append(kinds[postId], kind)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return kinds, nil
+}
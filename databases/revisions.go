@@ -0,0 +1,74 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func (repo *PostgresRepository) ListPostRevisions(ctx context.Context, postId string) ([]*models.PostRevision, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT post_id, revision, post_content, format, created_at
+		FROM post_revisions WHERE post_id = $1 ORDER BY revision DESC`,
+		postId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	revisions := make([]*models.PostRevision, 0)
+	for rows.Next() {
+		revision, err := scanPostRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// GetPostRevision returns nil when the post has no such revision.
+func (repo *PostgresRepository) GetPostRevision(ctx context.Context, postId string, revision int) (*models.PostRevision, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT post_id, revision, post_content, format, created_at
+		FROM post_revisions WHERE post_id = $1 AND revision = $2`,
+		postId,
+		revision,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	var found *models.PostRevision
+	for rows.Next() {
+		if found, err = scanPostRevision(rows); err != nil {
+			return nil, err
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return found, nil
+}
+
+func scanPostRevision(rows *sql.Rows) (*models.PostRevision, error) {
+	revision := models.PostRevision{}
+	if err := rows.Scan(
+		&revision.PostId,
+		&revision.Revision,
+		&revision.PostContent,
+		&revision.Format,
+		&revision.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &revision, nil
+}
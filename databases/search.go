@@ -0,0 +1,60 @@
+package databases
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// ts_headline cannot escape HTML, so matches are delimited with private use
+// characters and turned into <mark> once the snippet has been escaped.
+const (
+	highlightStart = "\ue000"
+	highlightStop  = "\ue001"
+)
+
+// SearchPosts ranks the posts matching the query using the full-text index
+// kept up to date by the posts_search_vector_update trigger.
+func (repo *PostgresRepository) SearchPosts(ctx context.Context, query *models.SearchQuery) ([]*models.SearchResult, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT `+postColumns+`,
+		ts_rank(search_vector, query),
+		ts_headline('english', post_content, query, $4)
+		FROM posts, plainto_tsquery('english', $1) query
+		WHERE search_vector @@ query AND status = $5 AND `+visibleTo("$6", true)+` AND `+notMuted("$6", "posts.user_id")+`
+		ORDER BY ts_rank(search_vector, query) DESC, created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`,
+		query.Text,
+		query.Limit,
+		query.Offset,
+		"StartSel="+highlightStart+", StopSel="+highlightStop+", MaxFragments=2",
+		models.POST_PUBLISHED,
+		query.ViewerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	results := make([]*models.SearchResult, 0)
+	for rows.Next() {
+		var post = models.Post{}
+		var result = models.SearchResult{Post: &post}
+		destinations := append(postDestinations(&post), &result.Rank, &result.Snippet)
+		if err = rows.Scan(destinations...); err != nil {
+			return nil, err
+		}
+		result.Snippet = strings.NewReplacer(
+			highlightStart, "<mark>",
+			highlightStop, "</mark>",
+		).Replace(html.EscapeString(result.Snippet))
+		results = append(results, &result)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,149 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/lib/pq"
+)
+
+func (repo *PostgresRepository) GetUsersByHandles(ctx context.Context, handles []string) ([]*models.User, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT id, email, password, handle FROM users WHERE handle = ANY($1)",
+		pq.Array(handles),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	users := make([]*models.User, 0)
+	for rows.Next() {
+		var user = models.User{}
+		var handle sql.NullString
+		if err = rows.Scan(&user.Id, &user.Email, &user.Password, &handle); err != nil {
+			return nil, err
+		}
+		user.Handle = handle.String
+		users = append(users, &user)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// ReplacePostTags makes tags the exact set of tags of the post.
+func (repo *PostgresRepository) ReplacePostTags(ctx context.Context, postId string, tags []string) error {
+	if tags == nil {
+		// a nil array is NULL, which would keep every tag
+		tags = []string{}
+	}
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM post_tags WHERE post_id = $1 AND NOT (tag = ANY($2))",
+		postId,
+		pq.Array(tags),
+	); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO post_tags (post_id, tag, created_at)
+		SELECT posts.id, tag, posts.created_at FROM posts, UNNEST($2::varchar[]) tag
+		WHERE posts.id = $1
+		ON CONFLICT DO NOTHING`,
+		postId,
+		pq.Array(tags),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReplacePostMentions makes userIds the exact set of users mentioned by the
+// post and returns the ones that were not mentioned before.
+func (repo *PostgresRepository) ReplacePostMentions(ctx context.Context, postId string, userIds []string) ([]string, error) {
+	if userIds == nil {
+		userIds = []string{}
+	}
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		"DELETE FROM post_mentions WHERE post_id = $1 AND NOT (user_id = ANY($2))",
+		postId,
+		pq.Array(userIds),
+	); err != nil {
+		return nil, err
+	}
+	rows, err := tx.QueryContext(
+		ctx,
+		`INSERT INTO post_mentions (post_id, user_id)
+		SELECT $1, UNNEST($2::varchar[])
+		ON CONFLICT DO NOTHING
+		RETURNING user_id`,
+		postId,
+		pq.Array(userIds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	added := make([]string, 0)
+	for rows.Next() {
+		var userId string
+		if err := rows.Scan(&userId); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		added = append(added, userId)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return added, tx.Commit()
+}
+
+// TrendingTags counts the tags used by posts created since the given time.
+func (repo *PostgresRepository) TrendingTags(ctx context.Context, since time.Time, limit uint64) ([]*models.TagCount, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT tag, COUNT(*) FROM post_tags
+		WHERE created_at >= $1 AND post_id IN (SELECT id FROM posts WHERE visibility = $3 AND deleted_at IS NULL AND hidden_at IS NULL)
+		GROUP BY tag ORDER BY COUNT(*) DESC, tag LIMIT $2`,
+		since,
+		limit,
+		models.VISIBILITY_PUBLIC,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	tags := make([]*models.TagCount, 0)
+	for rows.Next() {
+		var tag = models.TagCount{}
+		if err = rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &tag)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tags, nil
+}
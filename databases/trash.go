@@ -0,0 +1,139 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/lib/pq"
+)
+
+// ListTrash returns the posts userId deleted that can still be restored,
+// newest first.
+func (repo *PostgresRepository) ListTrash(ctx context.Context, userId string, cursor *models.PostCursor, limit uint64) ([]*models.Post, error) {
+	var after sql.NullTime
+	var afterId string
+	if cursor != nil {
+		after = sql.NullTime{Time: cursor.CreatedAt, Valid: true}
+		afterId = cursor.Id
+	}
+
+	rows, err := repo.db.QueryContext(
+		ctx,
+		`SELECT `+postColumns+` FROM posts
+		WHERE user_id = $1 AND deleted_at > NOW() - $2::interval
+		AND ($3::timestamp IS NULL OR (created_at, id) < ($3, $4))
+		ORDER BY created_at DESC, id DESC LIMIT $5`,
+		userId,
+		interval(models.POST_TRASH_RETENTION),
+		after,
+		afterId,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+	return mapFromRowsToPosts(rows)
+}
+
+// RestorePost takes a post of userId out of the trash. It returns
+// repository.ErrNotFound when the post is not in the trash or its retention
+// is over.
+func (repo *PostgresRepository) RestorePost(ctx context.Context, post *models.Post) error {
+	err := repo.db.QueryRowContext(
+		ctx,
+		`UPDATE posts SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at > NOW() - $3::interval
+		RETURNING `+postColumns,
+		post.Id,
+		post.UserId,
+		interval(models.POST_TRASH_RETENTION),
+	).Scan(postDestinations(post)...)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	return err
+}
+
+// PurgeDeletedPosts permanently removes up to limit posts deleted longer
+// than olderThan ago, along with everything attached to them. It returns how
+// many posts were removed and the storage keys of their attachments, which
+// the caller has to delete.
+func (repo *PostgresRepository) PurgeDeletedPosts(ctx context.Context, olderThan time.Duration, limit int) (int, []string, error) {
+	tx, err := repo.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(
+		ctx,
+		`SELECT id FROM posts WHERE deleted_at < NOW() - $1::interval
+		ORDER BY deleted_at LIMIT $2 FOR UPDATE SKIP LOCKED`,
+		interval(olderThan),
+		limit,
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			handleCloseCursor(rows)
+			return 0, nil, err
+		}
+		ids = append(ids, id)
+	}
+	handleCloseCursor(rows)
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	rows, err = tx.QueryContext(
+		ctx,
+		`SELECT storage_key FROM attachments WHERE post_id = ANY($1)
+		UNION ALL
+		SELECT v.storage_key FROM attachment_variants v
+		JOIN attachments a ON a.id = v.attachment_id WHERE a.post_id = ANY($1)`,
+		pq.Array(ids),
+	)
+	if err != nil {
+		return 0, nil, err
+	}
+	keys := make([]string, 0)
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			handleCloseCursor(rows)
+			return 0, nil, err
+		}
+		keys = append(keys, key)
+	}
+	handleCloseCursor(rows)
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM posts WHERE id = ANY($1)", pq.Array(ids)); err != nil {
+		return 0, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return len(ids), keys, nil
+}
+
+// interval formats d as a Postgres interval, so that cutoffs are computed
+// against the clock of the database that set deleted_at rather than the
+// clock of this instance.
+func interval(d time.Duration) string {
+	return fmt.Sprintf("%d microseconds", d.Microseconds())
+}
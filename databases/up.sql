@@ -4,14 +4,278 @@ CREATE TABLE users (
     id          VARCHAR(32) PRIMARY KEY,
     password    VARCHAR(255) NOT NULL,
     email       VARCHAR(255) NOT NULL,
+    handle      VARCHAR(32),
     created_at  TIMESTAMP NOT NULL DEFAULT NOW(),
-    CONSTRAINT  email_unique UNIQUE (email)
+    CONSTRAINT  email_unique UNIQUE (email),
+    CONSTRAINT  handle_unique UNIQUE (handle)
 );
 
 CREATE TABLE posts (
     id  VARCHAR(32) PRIMARY KEY,
-    post_content VARCHAR(32) NOT NULL,
+    post_content TEXT NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain',
+    -- post_content rendered and sanitized when saved
+    post_html TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    -- set on the first edit
+    updated_at TIMESTAMP,
     user_id VARCHAR(32) NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'published',
+    -- when a scheduled post is due
+    publish_at TIMESTAMP,
+    visibility VARCHAR(16) NOT NULL DEFAULT 'public',
+    -- posts in the trash, purged once the retention is over
+    deleted_at TIMESTAMP,
+    -- hidden by moderation
+    hidden_at TIMESTAMP,
+    search_vector TSVECTOR,
     FOREIGN KEY (user_id) REFERENCES users(id)
 );
+
+CREATE INDEX posts_scheduled_publish_at ON posts (publish_at) WHERE status = 'scheduled';
+CREATE INDEX posts_deleted_at ON posts (user_id, deleted_at) WHERE deleted_at IS NOT NULL;
+
+CREATE INDEX posts_search_vector ON posts USING GIN (search_vector);
+
+CREATE TRIGGER posts_search_vector_update
+    BEFORE INSERT OR UPDATE OF post_content ON posts
+    FOR EACH ROW EXECUTE PROCEDURE
+    tsvector_update_trigger(search_vector, 'pg_catalog.english', post_content);
+
+CREATE TABLE conversations (
+    id  VARCHAR(32) PRIMARY KEY,
+    first_user_id VARCHAR(32) NOT NULL,
+    second_user_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (first_user_id) REFERENCES users(id),
+    FOREIGN KEY (second_user_id) REFERENCES users(id),
+    CONSTRAINT conversation_members_unique UNIQUE (first_user_id, second_user_id)
+);
+
+CREATE TABLE messages (
+    id  VARCHAR(32) PRIMARY KEY,
+    conversation_id VARCHAR(32) NOT NULL,
+    sender_id VARCHAR(32) NOT NULL,
+    recipient_id VARCHAR(32) NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    delivered_at TIMESTAMP,
+    read_at TIMESTAMP,
+    FOREIGN KEY (conversation_id) REFERENCES conversations(id),
+    FOREIGN KEY (sender_id) REFERENCES users(id),
+    FOREIGN KEY (recipient_id) REFERENCES users(id)
+);
+
+CREATE INDEX messages_conversation_created_at ON messages (conversation_id, created_at);
+
+CREATE TABLE comments (
+    id  VARCHAR(32) PRIMARY KEY,
+    post_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    parent_id VARCHAR(32),
+    depth INTEGER NOT NULL DEFAULT 0,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX comments_post_created_at ON comments (post_id, created_at);
+
+CREATE TABLE reactions (
+    post_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id, kind),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE post_reaction_counts (
+    post_id VARCHAR(32) NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    count BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (post_id, kind),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE follows (
+    follower_id VARCHAR(32) NOT NULL,
+    followed_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (follower_id, followed_id),
+    FOREIGN KEY (follower_id) REFERENCES users(id),
+    FOREIGN KEY (followed_id) REFERENCES users(id)
+);
+
+CREATE INDEX follows_followed_id ON follows (followed_id);
+CREATE INDEX posts_user_created_at ON posts (user_id, created_at DESC, id DESC);
+
+-- only used with TIMELINE_STRATEGY=write
+CREATE TABLE timeline_entries (
+    user_id VARCHAR(32) NOT NULL,
+    post_id VARCHAR(32) NOT NULL,
+    author_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, post_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX timeline_entries_user_created_at ON timeline_entries (user_id, created_at DESC, post_id DESC);
+
+CREATE TABLE post_tags (
+    post_id VARCHAR(32) NOT NULL,
+    tag VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (post_id, tag),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX post_tags_tag_created_at ON post_tags (tag, created_at DESC);
+CREATE INDEX post_tags_created_at ON post_tags (created_at);
+
+CREATE TABLE post_mentions (
+    post_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    PRIMARY KEY (post_id, user_id),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE attachments (
+    id  VARCHAR(32) PRIMARY KEY,
+    post_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER,
+    height INTEGER,
+    status VARCHAR(16) NOT NULL DEFAULT 'ready',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE INDEX attachments_post_id ON attachments (post_id);
+CREATE INDEX attachments_processing ON attachments (created_at) WHERE status = 'processing';
+
+CREATE TABLE attachment_variants (
+    attachment_id VARCHAR(32) NOT NULL,
+    name VARCHAR(32) NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    content_type VARCHAR(64) NOT NULL,
+    size BIGINT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    PRIMARY KEY (attachment_id, name),
+    FOREIGN KEY (attachment_id) REFERENCES attachments(id) ON DELETE CASCADE
+);
+
+-- every version of a post, the original being revision 1
+CREATE TABLE post_revisions (
+    post_id VARCHAR(32) NOT NULL,
+    revision INTEGER NOT NULL,
+    post_content TEXT NOT NULL,
+    format VARCHAR(16) NOT NULL DEFAULT 'plain',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, revision),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+-- fetched pages, shared by every post linking to them
+CREATE TABLE link_previews (
+    url TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    image_url TEXT NOT NULL DEFAULT '',
+    site_name TEXT NOT NULL DEFAULT '',
+    fetched_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE post_link_previews (
+    post_id VARCHAR(32) NOT NULL,
+    url TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    PRIMARY KEY (post_id, url),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (url) REFERENCES link_previews(url)
+);
+
+-- reports without a reporter are filed by the content filters
+CREATE TABLE reports (
+    id  VARCHAR(32) PRIMARY KEY,
+    post_id VARCHAR(32) NOT NULL,
+    reporter_id VARCHAR(32),
+    reason TEXT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    resolved_at TIMESTAMP,
+    resolved_by VARCHAR(32),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (reporter_id) REFERENCES users(id),
+    FOREIGN KEY (resolved_by) REFERENCES users(id)
+);
+
+CREATE UNIQUE INDEX reports_open_reporter ON reports (post_id, COALESCE(reporter_id, '')) WHERE status = 'open';
+CREATE INDEX reports_status_created_at ON reports (status, created_at DESC);
+
+-- posts and reports are not foreign keys, the log outlives them
+CREATE TABLE moderation_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id VARCHAR(32),
+    action VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32),
+    post_id VARCHAR(32),
+    report_id VARCHAR(32),
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- blocks hide both users from each other and prevent any interaction
+CREATE TABLE blocks (
+    blocker_id VARCHAR(32) NOT NULL,
+    blocked_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (blocker_id, blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id),
+    FOREIGN KEY (blocked_id) REFERENCES users(id)
+);
+
+CREATE INDEX blocks_blocked_id ON blocks (blocked_id);
+
+-- mutes only hide the muted user from the muter
+CREATE TABLE mutes (
+    muter_id VARCHAR(32) NOT NULL,
+    muted_id VARCHAR(32) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (muter_id, muted_id),
+    FOREIGN KEY (muter_id) REFERENCES users(id),
+    FOREIGN KEY (muted_id) REFERENCES users(id)
+);
+
+CREATE INDEX mutes_muted_id ON mutes (muted_id);
+
+-- hub events relayed between instances, see databases/notify.go; the id is
+-- the event id every instance hands to its clients
+CREATE TABLE hub_events (
+    id BIGSERIAL PRIMARY KEY,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+-- open connections of each user per hub instance, see databases/presence.go
+CREATE TABLE hub_presence (
+    hub_id VARCHAR(32) NOT NULL,
+    user_id VARCHAR(32) NOT NULL,
+    connections INTEGER NOT NULL DEFAULT 0,
+    seen_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (hub_id, user_id)
+);
+
+CREATE INDEX hub_presence_user_id ON hub_presence (user_id);
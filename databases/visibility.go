@@ -0,0 +1,71 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+)
+
+// visibleTo is the condition matching the posts the viewer bound to the
+// viewer placeholder may read; an empty viewer is an anonymous caller.
+// Authors always see their own posts, except those in the trash, while posts
+// hidden by moderation or written by users blocking the viewer or blocked by
+// them are left out for everyone else. Listed queries leave out the
+// unlisted posts of others.
+func visibleTo(viewer string, listed bool) string {
+	visibilities := fmt.Sprintf("posts.visibility = '%s'", models.VISIBILITY_PUBLIC)
+	if !listed {
+		visibilities += fmt.Sprintf(" OR posts.visibility = '%s'", models.VISIBILITY_UNLISTED)
+	}
+	return fmt.Sprintf(
+		`posts.deleted_at IS NULL AND (posts.user_id = %[1]s OR (posts.hidden_at IS NULL AND posts.status = '%[2]s' AND %[5]s AND (%[3]s
+		OR (posts.visibility = '%[4]s' AND EXISTS (
+			SELECT 1 FROM follows WHERE follows.follower_id = %[1]s AND follows.followed_id = posts.user_id
+		)))))`,
+		viewer,
+		models.POST_PUBLISHED,
+		visibilities,
+		models.VISIBILITY_FOLLOWERS,
+		notBlocked(viewer, "posts.user_id"),
+	)
+}
+
+// GetVisiblePost returns nil when there is no such post or viewerId may not
+// read it.
+func (repo *PostgresRepository) GetVisiblePost(ctx context.Context, id string, viewerId string) (*models.Post, error) {
+	rows, err := repo.db.QueryContext(
+		ctx,
+		"SELECT "+postColumns+" FROM posts WHERE posts.id = $1 AND "+visibleTo("$2", false),
+		id,
+		viewerId,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer handleCloseCursor(rows)
+
+	post, err := mapFromRowsToPost(rows)
+	if err != nil || post.Id == "" {
+		return nil, err
+	}
+	return post, nil
+}
+
+// SetPostVisibility returns repository.ErrNotFound when userId does not own
+// a post with that id.
+func (repo *PostgresRepository) SetPostVisibility(ctx context.Context, post *models.Post) error {
+	err := repo.db.QueryRowContext(
+		ctx,
+		"UPDATE posts SET visibility = $3 WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL RETURNING "+postColumns,
+		post.Id,
+		post.UserId,
+		post.Visibility,
+	).Scan(postDestinations(post)...)
+	if err == sql.ErrNoRows {
+		return repository.ErrNotFound
+	}
+	return err
+}
@@ -8,7 +8,18 @@ require (
 	github.com/gorilla/websocket v1.5.0
 	github.com/joho/godotenv v1.4.0
 	github.com/lib/pq v1.10.7
+	github.com/microcosm-cc/bluemonday v1.0.23
 	github.com/rs/cors v1.8.2
 	github.com/segmentio/ksuid v1.0.4
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+	github.com/yuin/goldmark v1.5.6
 	golang.org/x/crypto v0.1.0
+	golang.org/x/image v0.5.0
+	golang.org/x/net v0.8.0
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.0 // indirect
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
 )
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/adrisongomez/project-go/media"
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	ATTACHMENT_URL_EXPIRY = 15 * time.Minute
+	// room for the multipart envelope around the file
+	MULTIPART_OVERHEAD = 1 << 20
+)
+
+// signAttachments fills in a fresh download URL on each attachment and its
+// variants.
+func signAttachments(s server.Server, attachments []*models.Attachment) error {
+	for _, attachment := range attachments {
+		// nothing is served before the metadata is stripped
+		if attachment.Status != models.ATTACHMENT_STATUS_READY {
+			continue
+		}
+		url, err := s.Storage().SignedURL(attachment.StorageKey, ATTACHMENT_URL_EXPIRY)
+		if err != nil {
+			return err
+		}
+		attachment.URL = url
+		for _, variant := range attachment.Variants {
+			if variant.URL, err = s.Storage().SignedURL(variant.StorageKey, ATTACHMENT_URL_EXPIRY); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// BindAttachmentEvents tells clients when the variants of an image are
+// available, so they can replace their placeholders.
+func BindAttachmentEvents(s server.Server) {
+	s.Media().OnProcessed(func(attachment *models.Attachment) {
+		messageType := models.ATTACHMENT_READY
+		if attachment.Status == models.ATTACHMENT_STATUS_FAILED {
+			messageType = models.ATTACHMENT_FAILED
+		} else if err := signAttachments(s, []*models.Attachment{attachment}); err != nil {
+			log.Println("attachments:", err)
+			return
+		}
+		ctx := context.Background()
+		post, err := repository.GetPostById(ctx, attachment.PostId)
+		if err != nil || post.Id == "" {
+			log.Println("attachments:", attachment.Id, err)
+			return
+		}
+		if err := sendForPost(ctx, s, post, models.WebsocketMessage{
+			Type:    messageType,
+			Payload: attachment,
+		}); err != nil {
+			log.Println("attachments:", attachment.Id, err)
+		}
+	})
+}
+
+func attachAttachments(ctx context.Context, s server.Server, posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+
+	attachments, err := repository.ListAttachments(ctx, postIds)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.Attachments = attachments[post.Id]
+		if err := signAttachments(s, post.Attachments); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decoratePosts adds what is stored next to the posts: reactions,
+// attachments and link previews.
+func decoratePosts(ctx context.Context, s server.Server, posts []*models.Post, userId string) error {
+	if err := attachReactions(ctx, posts, userId); err != nil {
+		return err
+	}
+	if err := attachCommentCounts(ctx, posts, userId); err != nil {
+		return err
+	}
+	if err := attachAttachments(ctx, s, posts); err != nil {
+		return err
+	}
+	return attachPreviews(ctx, posts)
+}
+
+// UploadAttachmentHandler stores the multipart "file" field on a post of the
+// caller. The type is sniffed from the content, never taken from the client.
+func UploadAttachmentHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+
+		post, err := repository.GetPostById(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if post.Id == "" || post.UserId != claims.UserId {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, models.MAX_ATTACHMENT_SIZE+MULTIPART_OVERHEAD)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, models.MAX_ATTACHMENT_SIZE+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) > models.MAX_ATTACHMENT_SIZE {
+			http.Error(w, "file is too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		contentType := http.DetectContentType(data)
+		extension, ok := models.ATTACHMENT_TYPES[contentType]
+		if !ok {
+			http.Error(w, fmt.Sprintf("%s files are not allowed", contentType), http.StatusUnsupportedMediaType)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		attachment := models.Attachment{
+			Id:          id.String(),
+			PostId:      post.Id,
+			UserId:      claims.UserId,
+			StorageKey:  "attachments/" + post.Id + "/" + id.String() + extension,
+			Filename:    filepath.Base(header.Filename),
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			Status:      models.ATTACHMENT_STATUS_READY,
+		}
+		if media.CanProcess(contentType) {
+			attachment.Status = models.ATTACHMENT_STATUS_PROCESSING
+		}
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			attachment.Width, attachment.Height = &config.Width, &config.Height
+		}
+
+		// images keep their metadata until processed, so they wait where
+		// they are never served from
+		key := attachment.StorageKey
+		if attachment.Status == models.ATTACHMENT_STATUS_PROCESSING {
+			key = media.UploadKey(attachment.StorageKey)
+		}
+		if err := s.Storage().Put(r.Context(), key, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := repository.InsertAttachment(r.Context(), &attachment); err != nil {
+			s.Storage().Delete(context.Background(), key)
+			if errors.Is(err, repository.ErrTooManyAttachments) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if attachment.Status == models.ATTACHMENT_STATUS_PROCESSING {
+			s.Media().Enqueue(&attachment)
+		}
+
+		if err := signAttachments(s, []*models.Attachment{&attachment}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&attachment)
+	}
+}
+
+func GetAttachmentHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		attachment, err := repository.GetAttachmentById(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if attachment == nil {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return
+		}
+		if findVisiblePost(w, r, attachment.PostId) == nil {
+			return
+		}
+		if err := signAttachments(s, []*models.Attachment{attachment}); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(attachment)
+	}
+}
+
+func DeleteAttachmentHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		attachment, err := repository.GetAttachmentById(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if attachment == nil || attachment.UserId != claims.UserId {
+			http.Error(w, "attachment not found", http.StatusNotFound)
+			return
+		}
+
+		if err := repository.DeleteAttachment(r.Context(), attachment.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		keys := []string{attachment.StorageKey, media.UploadKey(attachment.StorageKey)}
+		for _, variant := range attachment.Variants {
+			keys = append(keys, variant.StorageKey)
+		}
+		for _, key := range keys {
+			if err := s.Storage().Delete(r.Context(), key); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		json.NewEncoder(w).Encode(&PostUpdateResponse{
+			Message: fmt.Sprintf("Attachment %s has been deleted", attachment.Id),
+		})
+	}
+}
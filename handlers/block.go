@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+type ListBlocksResponse struct {
+	Users []*models.Block `json:"users"`
+}
+
+type ListMutesResponse struct {
+	Users []*models.Mute `json:"users"`
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// BindBlocks keeps the hub from pushing what users do, such as their
+// presence or typing signals, to the users blocking or muting them.
+func BindBlocks(s server.Server) {
+	s.Hub().ExcludeRecipients(excludedUsers)
+}
+
+// excludedUsers gathers the users who must not be sent what any of userIds
+// does.
+func excludedUsers(ctx context.Context, userIds []string) ([]string, error) {
+	excluded := make([]string, 0)
+	for _, userId := range userIds {
+		users, err := repository.ListExcludedUsers(ctx, userId)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
+			if !containsString(excluded, user) {
+				excluded = append(excluded, user)
+			}
+		}
+	}
+	return excluded, nil
+}
+
+// checkNotBlocked answers 403 when either user blocked the other. It returns
+// false once an error has been written.
+func checkNotBlocked(w http.ResponseWriter, r *http.Request, userId string, otherId string) bool {
+	blocked, err := repository.AreBlocked(r.Context(), userId, otherId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if blocked {
+		http.Error(w, "you cannot interact with this user", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// findOtherUser loads the user in the route, who must not be the caller. It
+// returns nil once an error has been written.
+func findOtherUser(w http.ResponseWriter, r *http.Request, userId string) *models.User {
+	id := mux.Vars(r)["id"]
+	if id == userId {
+		http.Error(w, "you cannot do this to yourself", http.StatusBadRequest)
+		return nil
+	}
+	user, err := repository.GetUserById(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if user == nil || user.Id == "" {
+		http.Error(w, "user not found", http.StatusNotFound)
+		return nil
+	}
+	return user
+}
+
+// BlockHandler hides the caller and the user from each other and prevents
+// them from following, replying to or messaging each other.
+func BlockHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		user := findOtherUser(w, r, claims.UserId)
+		if user == nil {
+			return
+		}
+		if err := repository.Block(r.Context(), claims.UserId, user.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func UnblockHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		if err := repository.Unblock(r.Context(), claims.UserId, mux.Vars(r)["id"]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListBlocksHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		blocks, err := repository.ListBlocks(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ListBlocksResponse{Users: blocks})
+	}
+}
+
+// MuteHandler hides the user from the caller's timeline, listings, search,
+// comments and notifications. The muted user is not told and can still
+// interact with the caller.
+func MuteHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		user := findOtherUser(w, r, claims.UserId)
+		if user == nil {
+			return
+		}
+		if err := repository.Mute(r.Context(), claims.UserId, user.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func UnmuteHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		if err := repository.Unmute(r.Context(), claims.UserId, mux.Vars(r)["id"]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListMutesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		mutes, err := repository.ListMutes(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ListMutesResponse{Users: mutes})
+	}
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// replies to a comment at this depth are rejected
+	MAX_COMMENT_DEPTH = 4
+)
+
+type UpsertCommentRequest struct {
+	Content  string  `json:"content"`
+	ParentId *string `json:"parent_id"`
+}
+
+type ListCommentsResponse struct {
+	Comments []*models.Comment `json:"comments"`
+}
+
+// attachCommentCounts leaves out of the comment counts the comments that
+// ListComments hides from userId.
+func attachCommentCounts(ctx context.Context, posts []*models.Post, userId string) error {
+	// nobody is blocked or muted by an anonymous viewer
+	if len(posts) == 0 || userId == "" {
+		return nil
+	}
+	postIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+	counts, err := repository.GetCommentCounts(ctx, postIds, userId)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.CommentCount = counts[post.Id]
+	}
+	return nil
+}
+
+// threadComments nests the replies under their parents. comments must be
+// sorted so parents come before their replies. Replies to a comment hidden
+// from the viewer are kept, at the top level.
+func threadComments(comments []*models.Comment) []*models.Comment {
+	byId := make(map[string]*models.Comment, len(comments))
+	roots := make([]*models.Comment, 0)
+	for _, comment := range comments {
+		byId[comment.Id] = comment
+		if comment.ParentId == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		if parent, ok := byId[*comment.ParentId]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		} else {
+			roots = append(roots, comment)
+		}
+	}
+	return roots
+}
+
+// getCommentForEdit loads the comment in the route and makes sure userId is
+// its author or the owner of the post. It writes the error response and
+// returns nil otherwise.
+func getCommentForEdit(w http.ResponseWriter, r *http.Request, userId string) *models.Comment {
+	comment, err := repository.GetCommentById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if comment == nil {
+		http.Error(w, "comment not found", http.StatusNotFound)
+		return nil
+	}
+	if comment.UserId == userId {
+		return comment
+	}
+
+	post, err := repository.GetPostById(r.Context(), comment.PostId)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if post.UserId != userId {
+		http.Error(w, "not allowed to change this comment", http.StatusForbidden)
+		return nil
+	}
+	return comment
+}
+
+func ListCommentsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := mux.Vars(r)
+		if findVisiblePost(w, r, params["id"]) == nil {
+			return
+		}
+		comments, err := repository.ListComments(r.Context(), params["id"], callerId(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&ListCommentsResponse{
+			Comments: threadComments(comments),
+		})
+	}
+}
+
+func InsertCommentHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+		var request = UpsertCommentRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Content == "" {
+			http.Error(w, "content is required", http.StatusBadRequest)
+			return
+		}
+
+		post := findVisiblePost(w, r, params["id"])
+		if post == nil {
+			return
+		}
+
+		depth := 0
+		if request.ParentId != nil {
+			parent, err := repository.GetCommentById(r.Context(), *request.ParentId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if parent == nil || parent.PostId != post.Id {
+				http.Error(w, "parent comment not found", http.StatusBadRequest)
+				return
+			}
+			blocked, err := repository.AreBlocked(r.Context(), claims.UserId, parent.UserId)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if blocked {
+				http.Error(w, "you cannot reply to this user", http.StatusForbidden)
+				return
+			}
+			if parent.Depth >= MAX_COMMENT_DEPTH {
+				http.Error(w, "replies are nested too deep", http.StatusBadRequest)
+				return
+			}
+			depth = parent.Depth + 1
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		comment := models.Comment{
+			Id:       id.String(),
+			PostId:   post.Id,
+			UserId:   claims.UserId,
+			ParentId: request.ParentId,
+			Depth:    depth,
+			Content:  request.Content,
+		}
+		if err := repository.InsertComment(r.Context(), &comment); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := sendForPost(r.Context(), s, post, models.WebsocketMessage{
+			Type:    models.COMMENT_CREATED,
+			Payload: comment,
+		}, comment.UserId); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&comment)
+	}
+}
+
+func UpdateCommentHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		var request = UpsertCommentRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Content == "" {
+			http.Error(w, "content is required", http.StatusBadRequest)
+			return
+		}
+
+		comment := getCommentForEdit(w, r, claims.UserId)
+		if comment == nil {
+			return
+		}
+		comment.Content = request.Content
+		if err := repository.UpdateComment(r.Context(), comment); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(comment)
+	}
+}
+
+func DeleteCommentHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		comment := getCommentForEdit(w, r, claims.UserId)
+		if comment == nil {
+			return
+		}
+		if err := repository.DeleteComment(r.Context(), comment.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&PostUpdateResponse{
+			Message: fmt.Sprintf("Comment %s has been deleted", comment.Id),
+		})
+	}
+}
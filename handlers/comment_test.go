@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func comment(id string, parentId string) *models.Comment {
+	c := &models.Comment{Id: id}
+	if parentId != "" {
+		c.ParentId = &parentId
+	}
+	return c
+}
+
+// shape renders a thread as nested ids, such as "a(b(c) d)".
+func shape(comments []*models.Comment) string {
+	text := ""
+	for i, c := range comments {
+		if i > 0 {
+			text += " "
+		}
+		text += c.Id
+		if len(c.Replies) > 0 {
+			text += "(" + shape(c.Replies) + ")"
+		}
+	}
+	return text
+}
+
+func TestThreadComments(t *testing.T) {
+	for name, test := range map[string]struct {
+		comments []*models.Comment
+		want     string
+	}{
+		"empty":       {[]*models.Comment{}, ""},
+		"flat":        {[]*models.Comment{comment("a", ""), comment("b", "")}, "a b"},
+		"nested":      {[]*models.Comment{comment("a", ""), comment("b", "a"), comment("c", "b"), comment("d", "a"), comment("e", "")}, "a(b(c) d) e"},
+		"interleaved": {[]*models.Comment{comment("a", ""), comment("b", ""), comment("c", "a"), comment("d", "b"), comment("e", "a")}, "a(c e) b(d)"},
+		// b is hidden from the viewer, its replies are kept
+		"orphans": {[]*models.Comment{comment("a", ""), comment("c", "b"), comment("d", "c"), comment("e", "a")}, "a(e) c(d)"},
+	} {
+		if got := shape(threadComments(test.comments)); got != test.want {
+			t.Errorf("%s: got %q, want %q", name, got, test.want)
+		}
+	}
+}
+
+func TestThreadCommentsEncodesEmptyList(t *testing.T) {
+	data, err := json.Marshal(&ListCommentsResponse{Comments: threadComments(nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"comments":[]}` {
+		t.Errorf("got %s", data)
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+type ListFollowsResponse struct {
+	Users []*models.Follow `json:"users"`
+}
+
+type TimelineResponse struct {
+	Posts      []*models.Post `json:"posts"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+func FollowHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+		if params["id"] == claims.UserId {
+			http.Error(w, "you cannot follow yourself", http.StatusBadRequest)
+			return
+		}
+
+		user, err := repository.GetUserById(r.Context(), params["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if user == nil || user.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		if !checkNotBlocked(w, r, claims.UserId, user.Id) {
+			return
+		}
+
+		if err := repository.Follow(r.Context(), claims.UserId, user.Id); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func UnfollowHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+		if err := repository.Unfollow(r.Context(), claims.UserId, params["id"]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func ListFollowersHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		followers, err := repository.ListFollowers(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ListFollowsResponse{Users: followers})
+	}
+}
+
+func ListFollowingHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		following, err := repository.ListFollowing(r.Context(), mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ListFollowsResponse{Users: following})
+	}
+}
+
+func TimelineHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		limit, err := parseLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cursor != nil && cursor.Backward {
+			http.Error(w, "the timeline only pages forward", http.StatusBadRequest)
+			return
+		}
+
+		posts, err := repository.GetTimeline(r.Context(), claims.UserId, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := decoratePosts(r.Context(), s, posts, claims.UserId); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		nextCursor, _ := pageCursors(posts, cursor, limit)
+		response := TimelineResponse{
+			Posts:      posts,
+			NextCursor: nextCursor,
+		}
+		json.NewEncoder(w).Encode(&response)
+	}
+}
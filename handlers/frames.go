@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/moderation"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/websockets"
+)
+
+type UpdatePostFrame struct {
+	Id string `json:"id"`
+	UpsertPostRequest
+}
+
+// BindFrameHandlers registers the request frames clients may send over the
+// websocket instead of calling the HTTP API.
+func BindFrameHandlers(s server.Server) {
+	s.Hub().HandleFrame("post.create", CreatePostFrameHandler(s))
+	s.Hub().HandleFrame("post.update", UpdatePostFrameHandler(s))
+	s.Hub().AuthorizeTopics(authorizeTopic)
+}
+
+// authorizeTopic allows the topics of the conversations of userId and of
+// the posts they can see; anonymous clients only get those of public posts.
+func authorizeTopic(ctx context.Context, userId string, topic string) (bool, error) {
+	kind, id, _ := strings.Cut(topic, ":")
+	switch kind {
+	case models.TOPIC_CONVERSATION:
+		if userId == "" {
+			return false, nil
+		}
+		conversation, err := repository.GetConversationById(ctx, id)
+		if err != nil {
+			return false, err
+		}
+		return conversation != nil && conversation.HasMember(userId), nil
+	case models.TOPIC_POST:
+		post, err := repository.GetVisiblePost(ctx, id, userId)
+		if err != nil {
+			return false, err
+		}
+		return post != nil, nil
+	}
+	return false, nil
+}
+
+func requireUser(client *websockets.Client) error {
+	if client.UserId() == "" {
+		return &models.RpcError{Status: http.StatusUnauthorized, Message: "authentication required"}
+	}
+	return nil
+}
+
+func CreatePostFrameHandler(s server.Server) websockets.FrameHandler {
+	return func(ctx context.Context, client *websockets.Client, payload json.RawMessage) (interface{}, error) {
+		if err := requireUser(client); err != nil {
+			return nil, err
+		}
+		var request = UpsertPostRequest{}
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, &models.RpcError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		if err := request.resolve(); err != nil {
+			return nil, &models.RpcError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+
+		post, err := createPost(ctx, s, client.UserId(), request)
+		if errors.Is(err, moderation.ErrRejected) {
+			return nil, &models.RpcError{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &PostResponse{
+			Id:          post.Id,
+			PostContent: post.PostContent,
+			Format:      post.Format,
+			PostHTML:    post.PostHTML,
+		}, nil
+	}
+}
+
+func UpdatePostFrameHandler(s server.Server) websockets.FrameHandler {
+	return func(ctx context.Context, client *websockets.Client, payload json.RawMessage) (interface{}, error) {
+		if err := requireUser(client); err != nil {
+			return nil, err
+		}
+		var request = UpdatePostFrame{}
+		if err := json.Unmarshal(payload, &request); err != nil {
+			return nil, &models.RpcError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+		if err := validatePostFormat(request.Format); err != nil {
+			return nil, &models.RpcError{Status: http.StatusBadRequest, Message: err.Error()}
+		}
+
+		post, err := updatePost(ctx, s, client.UserId(), request.Id, request.UpsertPostRequest)
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, &models.RpcError{Status: http.StatusNotFound, Message: "post not found"}
+		}
+		if errors.Is(err, moderation.ErrRejected) {
+			return nil, &models.RpcError{Status: http.StatusUnprocessableEntity, Message: err.Error()}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &PostUpdateResponse{
+			Message: fmt.Sprintf("`post_content` updated on post %s", post.Id),
+		}, nil
+	}
+}
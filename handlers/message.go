@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+type CreateConversationRequest struct {
+	UserId string `json:"user_id"`
+}
+
+type ListConversationsResponse struct {
+	Conversations []*models.Conversation `json:"conversations"`
+}
+
+type InsertMessageRequest struct {
+	Content string `json:"content"`
+}
+
+type ListMessagesResponse struct {
+	Messages   []*models.Message `json:"messages"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// getConversationForUser loads the conversation in the route and makes sure
+// userId takes part in it. It writes the error response and returns nil
+// otherwise.
+func getConversationForUser(w http.ResponseWriter, r *http.Request, userId string) *models.Conversation {
+	conversation, err := repository.GetConversationById(r.Context(), mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if conversation == nil || !conversation.HasMember(userId) {
+		http.Error(w, "conversation not found", http.StatusNotFound)
+		return nil
+	}
+	return conversation
+}
+
+func CreateConversationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		var request = CreateConversationRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.UserId == "" || request.UserId == claims.UserId {
+			http.Error(w, "invalid user_id", http.StatusBadRequest)
+			return
+		}
+		if !checkNotBlocked(w, r, claims.UserId, request.UserId) {
+			return
+		}
+
+		other, err := repository.GetUserById(r.Context(), request.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if other == nil || other.Id == "" {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+
+		// members are stored ordered so each pair has a single conversation
+		first, second := claims.UserId, request.UserId
+		if second < first {
+			first, second = second, first
+		}
+
+		conversation, err := repository.GetConversationByMembers(r.Context(), first, second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if conversation != nil {
+			json.NewEncoder(w).Encode(conversation)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		conversation = &models.Conversation{
+			Id:           id.String(),
+			FirstUserId:  first,
+			SecondUserId: second,
+			CreatedAt:    time.Now(),
+		}
+		if err := repository.InsertConversation(r.Context(), conversation); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(conversation)
+	}
+}
+
+func ListConversationsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		conversations, err := repository.ListConversations(r.Context(), claims.UserId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&ListConversationsResponse{
+			Conversations: conversations,
+		})
+	}
+}
+
+func InsertMessageHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		conversation := getConversationForUser(w, r, claims.UserId)
+		if conversation == nil {
+			return
+		}
+
+		var request = InsertMessageRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Content == "" {
+			http.Error(w, "content is required", http.StatusBadRequest)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message := models.Message{
+			Id:             id.String(),
+			ConversationId: conversation.Id,
+			SenderId:       claims.UserId,
+			RecipientId:    conversation.OtherMember(claims.UserId),
+			Content:        request.Content,
+		}
+		if !checkNotBlocked(w, r, message.SenderId, message.RecipientId) {
+			return
+		}
+		if err := repository.InsertMessage(r.Context(), &message); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the message is still stored for a recipient who muted the sender,
+		// they are only not told about it
+		muted, err := repository.IsMuted(r.Context(), message.RecipientId, message.SenderId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !muted {
+			s.Hub().SendToUser(message.RecipientId, models.WebsocketMessage{
+				Type:    models.MESSAGE_CREATED,
+				Payload: message,
+			})
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&message)
+	}
+}
+
+// BindMessageDeliveries marks the messages pushed to a connection of their
+// recipient as delivered, as fetching them would.
+func BindMessageDeliveries(s server.Server) {
+	s.Hub().OnDelivered(models.MESSAGE_CREATED, func(userId string, payload json.RawMessage) {
+		var message models.Message
+		if err := json.Unmarshal(payload, &message); err != nil {
+			log.Println("messages:", err)
+			return
+		}
+		if err := markDelivered(context.Background(), s, message.ConversationId, userId, message.SenderId); err != nil {
+			log.Println("messages:", message.Id, err)
+		}
+	})
+}
+
+// markDelivered marks the messages of the conversation pending for userId
+// as delivered, and tells senderId, the other member, if there were any.
+func markDelivered(ctx context.Context, s server.Server, conversationId string, userId string, senderId string) error {
+	now := time.Now()
+	delivered, err := repository.MarkMessagesDelivered(ctx, conversationId, userId, now)
+	if err != nil {
+		return err
+	}
+	if delivered > 0 {
+		s.Hub().SendToUser(senderId, models.WebsocketMessage{
+			Type: models.MESSAGE_DELIVERED,
+			Payload: models.MessageReceiptPayload{
+				ConversationId: conversationId,
+				UserId:         userId,
+				At:             now,
+			},
+		})
+	}
+	return nil
+}
+
+// ListMessagesHandler returns the history newest first, paging towards
+// older messages with the cursor returned with each page. Fetching it counts
+// as delivery of the caller's pending messages.
+func ListMessagesHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		conversation := getConversationForUser(w, r, claims.UserId)
+		if conversation == nil {
+			return
+		}
+
+		if r.URL.Query().Get("page") != "" {
+			http.Error(w, "page is no longer supported, use cursor", http.StatusBadRequest)
+			return
+		}
+		limit, err := parseLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cursor != nil && cursor.Backward {
+			http.Error(w, "the history only pages towards older messages", http.StatusBadRequest)
+			return
+		}
+
+		err = markDelivered(r.Context(), s, conversation.Id, claims.UserId, conversation.OtherMember(claims.UserId))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		messages, err := repository.ListMessages(r.Context(), conversation.Id, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := ListMessagesResponse{Messages: messages}
+		if n := len(messages); uint64(n) == limit {
+			response.NextCursor = utils.EncodeCursor(&models.PostCursor{
+				CreatedAt: messages[n-1].CreatedAt,
+				Id:        messages[n-1].Id,
+			})
+		}
+		json.NewEncoder(w).Encode(&response)
+	}
+}
+
+func ReadConversationHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		conversation := getConversationForUser(w, r, claims.UserId)
+		if conversation == nil {
+			return
+		}
+
+		now := time.Now()
+		read, err := repository.MarkMessagesRead(r.Context(), conversation.Id, claims.UserId, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if read > 0 {
+			s.Hub().SendToUser(conversation.OtherMember(claims.UserId), models.WebsocketMessage{
+				Type: models.MESSAGE_READ,
+				Payload: models.MessageReceiptPayload{
+					ConversationId: conversation.Id,
+					UserId:         claims.UserId,
+					At:             now,
+				},
+			})
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/moderation"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+	"github.com/segmentio/ksuid"
+)
+
+type ReportPostRequest struct {
+	Reason string `json:"reason"`
+}
+
+type ListReportsResponse struct {
+	Page    uint64           `json:"page"`
+	Reports []*models.Report `json:"reports"`
+}
+
+type ModerationLogResponse struct {
+	Page    uint64                       `json:"page"`
+	Entries []*models.ModerationLogEntry `json:"entries"`
+}
+
+// moderate runs content by the filters and classifiers before it is saved.
+// Rejections are logged and returned as an error wrapping
+// moderation.ErrRejected.
+func moderate(ctx context.Context, s server.Server, userId string, postId string, content string) (*moderation.Verdict, error) {
+	verdict, err := s.Moderator().Check(ctx, content)
+	if err != nil {
+		return nil, err
+	}
+	if verdict.Action == moderation.ACTION_REJECT {
+		if err := repository.InsertModerationLog(ctx, &models.ModerationLogEntry{
+			Action: models.MODERATION_REJECTED,
+			UserId: userId,
+			PostId: postId,
+			Reason: verdict.Reason,
+		}); err != nil {
+			return nil, err
+		}
+	}
+	return verdict, verdict.Err()
+}
+
+// flagPost queues a post the filters flagged for review. A post already
+// waiting for review is not queued twice.
+func flagPost(ctx context.Context, postId string, verdict *moderation.Verdict) error {
+	if verdict.Action != moderation.ACTION_FLAG {
+		return nil
+	}
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return err
+	}
+	_, err = repository.InsertReport(ctx, &models.Report{
+		Id:     id.String(),
+		PostId: postId,
+		Reason: verdict.Reason,
+	}, 0)
+	if errors.Is(err, repository.ErrAlreadyReported) {
+		return nil
+	}
+	return err
+}
+
+func parsePage(r *http.Request) (uint64, error) {
+	pageStr := r.URL.Query().Get("page")
+	if pageStr == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(pageStr, 10, 64)
+}
+
+// ReportPostHandler files a report on a post the caller can see, other than
+// their own. When the report hides the post, whoever was sent the post is
+// told to drop it.
+func ReportPostHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		var request = ReportPostRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Reason = strings.TrimSpace(request.Reason)
+		if request.Reason == "" || utf8.RuneCountInString(request.Reason) > models.MAX_REPORT_REASON {
+			http.Error(w, "reason must be between 1 and 1000 characters", http.StatusBadRequest)
+			return
+		}
+
+		post := findVisiblePost(w, r, mux.Vars(r)["id"])
+		if post == nil {
+			return
+		}
+		if post.UserId == claims.UserId {
+			http.Error(w, "you cannot report your own post", http.StatusBadRequest)
+			return
+		}
+
+		id, err := ksuid.NewRandom()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		report := models.Report{
+			Id:         id.String(),
+			PostId:     post.Id,
+			ReporterId: claims.UserId,
+			Reason:     request.Reason,
+		}
+		hidden, err := repository.InsertReport(r.Context(), &report, s.Config().AutoHideReports)
+		if errors.Is(err, repository.ErrAlreadyReported) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the report is filed, a lost event only leaves the post on screen
+		if hidden {
+			if err := sendForPost(r.Context(), s, post, models.WebsocketMessage{
+				Type:    models.POST_HIDDEN,
+				Payload: models.PostHiddenPayload{PostId: post.Id},
+			}); err != nil {
+				log.Println("moderation:", post.Id, err)
+			}
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(&report)
+	}
+}
+
+// ListReportsHandler is the review queue: the open reports, newest first, or
+// those with the status in the query.
+func ListReportsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "":
+			status = models.REPORT_OPEN
+		case models.REPORT_OPEN, models.REPORT_RESOLVED, models.REPORT_DISMISSED:
+		default:
+			http.Error(w, "status must be open, resolved or dismissed", http.StatusBadRequest)
+			return
+		}
+		page, err := parsePage(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reports, err := repository.ListReports(r.Context(), status, page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ListReportsResponse{
+			Page:    page,
+			Reports: reports,
+		})
+	}
+}
+
+// closeReportHandler applies the decision of a moderator to every open
+// report on the post of the report in the route.
+func closeReportHandler(s server.Server, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		report := models.Report{
+			Id:         mux.Vars(r)["id"],
+			Status:     status,
+			ResolvedBy: claims.UserId,
+		}
+		err := repository.CloseReport(r.Context(), &report)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "no open report with this id", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&report)
+	}
+}
+
+// ResolveReportHandler upholds a report, which hides the post.
+func ResolveReportHandler(s server.Server) http.HandlerFunc {
+	return closeReportHandler(s, models.REPORT_RESOLVED)
+}
+
+// DismissReportHandler rejects a report, which shows the post again if the
+// reports had hidden it.
+func DismissReportHandler(s server.Server) http.HandlerFunc {
+	return closeReportHandler(s, models.REPORT_DISMISSED)
+}
+
+func ModerationLogHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		page, err := parsePage(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := repository.ListModerationLog(r.Context(), page)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ModerationLogResponse{
+			Page:    page,
+			Entries: entries,
+		})
+	}
+}
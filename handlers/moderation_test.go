@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/websockets"
+	"github.com/gorilla/mux"
+)
+
+// testServer is a server.Server with a config and a hub; every other
+// method panics.
+type testServer struct {
+	server.Server
+	config *server.Config
+	hub    *websockets.Hub
+}
+
+func (s *testServer) Config() *server.Config {
+	return s.config
+}
+
+func (s *testServer) Hub() *websockets.Hub {
+	return s.hub
+}
+
+// recordingBackplane keeps what the hub publishes instead of delivering it.
+type recordingBackplane struct {
+	published [][]byte
+}
+
+func (b *recordingBackplane) Publish(payload []byte, sequenced bool) error {
+	b.published = append(b.published, payload)
+	return nil
+}
+
+func (b *recordingBackplane) Subscribe(handler func(id uint64, payload []byte), onGap func()) {}
+
+func (b *recordingBackplane) Close() error {
+	return nil
+}
+
+type sentMessage struct {
+	Audience struct {
+		UserIds   []string `json:"user_ids"`
+		SenderIds []string `json:"sender_ids"`
+	} `json:"audience"`
+	Message struct {
+		Type    string                   `json:"type"`
+		Payload models.PostHiddenPayload `json:"payload"`
+	} `json:"message"`
+}
+
+// reportRepository files every report, hiding the post when hide is set.
+type reportRepository struct {
+	repository.Repository
+	post      *models.Post
+	hide      bool
+	hideAfter int
+}
+
+func (repo *reportRepository) GetVisiblePost(ctx context.Context, id string, viewerId string) (*models.Post, error) {
+	return repo.post, nil
+}
+
+func (repo *reportRepository) InsertReport(ctx context.Context, report *models.Report, hideAfter int) (bool, error) {
+	repo.hideAfter = hideAfter
+	return repo.hide, nil
+}
+
+func (repo *reportRepository) ListFollowers(ctx context.Context, userId string) ([]*models.Follow, error) {
+	return []*models.Follow{{UserId: "carol"}}, nil
+}
+
+func TestReportPostHandler(t *testing.T) {
+	for name, test := range map[string]struct {
+		visibility string
+		hide       bool
+		// recipients of the post.hidden event, nil when broadcast
+		userIds []string
+	}{
+		"reported":                {models.VISIBILITY_PUBLIC, false, nil},
+		"hidden":                  {models.VISIBILITY_PUBLIC, true, nil},
+		"hidden followers post":   {models.VISIBILITY_FOLLOWERS, true, []string{"alice", "carol"}},
+		"reported followers post": {models.VISIBILITY_FOLLOWERS, false, nil},
+	} {
+		repo := &reportRepository{
+			post: &models.Post{Id: "p1", UserId: "alice", Status: models.POST_PUBLISHED, Visibility: test.visibility},
+			hide: test.hide,
+		}
+		useRepository(t, repo)
+		backplane := &recordingBackplane{}
+		hub := websockets.NewHub()
+		hub.UseBackplane(backplane)
+		s := &testServer{config: &server.Config{AutoHideReports: 3}, hub: hub}
+
+		request := httptest.NewRequest(http.MethodPost, "/posts/p1/reports", strings.NewReader(`{"reason":"spam"}`))
+		request = mux.SetURLVars(signedIn(request, "bob"), map[string]string{"id": "p1"})
+		recorder := httptest.NewRecorder()
+		ReportPostHandler(s)(recorder, request)
+
+		if recorder.Code != http.StatusCreated {
+			t.Errorf("%s: got %d, want 201", name, recorder.Code)
+			continue
+		}
+		if repo.hideAfter != 3 {
+			t.Errorf("%s: hidden after %d reports, want 3", name, repo.hideAfter)
+		}
+		if !test.hide {
+			if len(backplane.published) != 0 {
+				t.Errorf("%s: %d messages sent for a post still shown", name, len(backplane.published))
+			}
+			continue
+		}
+		if len(backplane.published) != 1 {
+			t.Errorf("%s: %d messages sent, want 1", name, len(backplane.published))
+			continue
+		}
+		var sent sentMessage
+		if err := json.Unmarshal(backplane.published[0], &sent); err != nil {
+			t.Fatal(err)
+		}
+		if sent.Message.Type != models.POST_HIDDEN || sent.Message.Payload.PostId != "p1" {
+			t.Errorf("%s: sent %+v", name, sent.Message)
+		}
+		if !reflect.DeepEqual(sent.Audience.UserIds, test.userIds) {
+			t.Errorf("%s: sent to %v, want %v", name, sent.Audience.UserIds, test.userIds)
+		}
+		if !reflect.DeepEqual(sent.Audience.SenderIds, []string{"alice"}) {
+			t.Errorf("%s: sent on behalf of %v, want the author", name, sent.Audience.SenderIds)
+		}
+	}
+}
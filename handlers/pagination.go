@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/utils"
+)
+
+const (
+	DEFAULT_PAGE_SIZE = 20
+	MAX_PAGE_SIZE     = 100
+)
+
+// parseLimit reads the page size from the query, defaulting to
+// DEFAULT_PAGE_SIZE and capped at MAX_PAGE_SIZE.
+func parseLimit(r *http.Request) (uint64, error) {
+	limitStr := r.URL.Query().Get("limit")
+	if limitStr == "" {
+		return DEFAULT_PAGE_SIZE, nil
+	}
+	limit, err := strconv.ParseUint(limitStr, 10, 64)
+	if err != nil || limit == 0 {
+		return 0, errors.New("invalid limit")
+	}
+	if limit > MAX_PAGE_SIZE {
+		limit = MAX_PAGE_SIZE
+	}
+	return limit, nil
+}
+
+func parseCursor(r *http.Request) (*models.PostCursor, error) {
+	token := r.URL.Query().Get("cursor")
+	if token == "" {
+		return nil, nil
+	}
+	return utils.DecodeCursor(token)
+}
+
+// pageCursors returns the tokens for the pages around posts, which were
+// fetched with cursor and limit. A token is empty when there is no page in
+// that direction.
+func pageCursors(posts []*models.Post, cursor *models.PostCursor, limit uint64) (next string, prev string) {
+	if len(posts) == 0 {
+		return "", ""
+	}
+	first, last := posts[0], posts[len(posts)-1]
+	full := uint64(len(posts)) == limit
+	backward := cursor != nil && cursor.Backward
+
+	if full || backward {
+		next = utils.EncodeCursor(&models.PostCursor{
+			CreatedAt: last.CreatedAt,
+			Id:        last.Id,
+		})
+	}
+	if (cursor != nil && !backward) || (backward && full) {
+		prev = utils.EncodeCursor(&models.PostCursor{
+			CreatedAt: first.CreatedAt,
+			Id:        first.Id,
+			Backward:  true,
+		})
+	}
+	return next, prev
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/utils"
+)
+
+func posts(ids ...string) []*models.Post {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := make([]*models.Post, 0, len(ids))
+	for i, id := range ids {
+		list = append(list, &models.Post{Id: id, CreatedAt: created.Add(-time.Duration(i) * time.Minute)})
+	}
+	return list
+}
+
+// pointsAt decodes token into "id" for forward cursors and "<id" for
+// backward ones, or "" when it is empty.
+func pointsAt(t *testing.T, token string) string {
+	t.Helper()
+	if token == "" {
+		return ""
+	}
+	cursor, err := utils.DecodeCursor(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Backward {
+		return "<" + cursor.Id
+	}
+	return cursor.Id
+}
+
+func TestPageCursors(t *testing.T) {
+	forward := &models.PostCursor{Id: "x"}
+	backward := &models.PostCursor{Id: "x", Backward: true}
+	for name, test := range map[string]struct {
+		posts      []*models.Post
+		cursor     *models.PostCursor
+		next, prev string
+	}{
+		"nothing":                   {posts(), nil, "", ""},
+		"nothing after a cursor":    {posts(), forward, "", ""},
+		"full first page":           {posts("a", "b", "c"), nil, "c", ""},
+		"short first page":          {posts("a", "b"), nil, "", ""},
+		"full middle page":          {posts("d", "e", "f"), forward, "f", "<d"},
+		"last page":                 {posts("g", "h"), forward, "", "<g"},
+		"full page backward":        {posts("d", "e", "f"), backward, "f", "<d"},
+		"first page paged backward": {posts("b", "c"), backward, "c", ""},
+	} {
+		next, prev := pageCursors(test.posts, test.cursor, 3)
+		if got := pointsAt(t, next); got != test.next {
+			t.Errorf("%s: next cursor at %q, want %q", name, got, test.next)
+		}
+		if got := pointsAt(t, prev); got != test.prev {
+			t.Errorf("%s: previous cursor at %q, want %q", name, got, test.prev)
+		}
+	}
+}
+
+func TestPageCursorsKeepPosition(t *testing.T) {
+	page := posts("a", "b", "c")
+	next, _ := pageCursors(page, nil, 3)
+	cursor, err := utils.DecodeCursor(next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cursor.CreatedAt.Equal(page[2].CreatedAt) {
+		t.Errorf("cursor at %v, want %v", cursor.CreatedAt, page[2].CreatedAt)
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	for query, want := range map[string]uint64{
+		"":           DEFAULT_PAGE_SIZE,
+		"?limit=1":   1,
+		"?limit=42":  42,
+		"?limit=100": MAX_PAGE_SIZE,
+		"?limit=101": MAX_PAGE_SIZE,
+		"?limit=1e9": 0,
+		"?limit=0":   0,
+		"?limit=-5":  0,
+		"?limit=ten": 0,
+	} {
+		limit, err := parseLimit(httptest.NewRequest("GET", "/posts"+query, nil))
+		if want == 0 {
+			if err == nil {
+				t.Errorf("parseLimit(%q) = %d, want an error", query, limit)
+			}
+			continue
+		}
+		if err != nil || limit != want {
+			t.Errorf("parseLimit(%q) = %d, %v, want %d", query, limit, err, want)
+		}
+	}
+}
+
+func TestParseCursor(t *testing.T) {
+	cursor, err := parseCursor(httptest.NewRequest("GET", "/posts", nil))
+	if cursor != nil || err != nil {
+		t.Errorf("got %v, %v without a cursor", cursor, err)
+	}
+	if _, err := parseCursor(httptest.NewRequest("GET", "/posts?cursor=garbage", nil)); err == nil {
+		t.Error("an invalid cursor was accepted")
+	}
+	token := utils.EncodeCursor(&models.PostCursor{Id: "a", Backward: true})
+	cursor, err = parseCursor(httptest.NewRequest("GET", "/posts?cursor="+token, nil))
+	if err != nil || cursor.Id != "a" || !cursor.Backward {
+		t.Errorf("got %+v, %v", cursor, err)
+	}
+}
@@ -1,12 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/moderation"
 	"github.com/adrisongomez/project-go/repository"
 	"github.com/adrisongomez/project-go/server"
 	"github.com/adrisongomez/project-go/utils"
@@ -16,11 +21,34 @@ import (
 
 type UpsertPostRequest struct {
 	PostContent string `json:"post_content"`
+	// plain or markdown; updates keep the current format when it is left out
+	Format string `json:"format,omitempty"`
+	// only read when the post is created
+	Status     string     `json:"status,omitempty"`
+	PublishAt  *time.Time `json:"publish_at,omitempty"`
+	Visibility string     `json:"visibility,omitempty"`
+}
+
+type PostVisibilityRequest struct {
+	Visibility string `json:"visibility"`
+}
+
+type PostStatusRequest struct {
+	Status    string     `json:"status"`
+	PublishAt *time.Time `json:"publish_at,omitempty"`
 }
 
 type PostResponse struct {
 	Id          string `json:"id"`
 	PostContent string `json:"post_content"`
+	Format      string `json:"format"`
+	PostHTML    string `json:"post_html"`
+}
+
+type SparseListPostResponse struct {
+	Posts      []map[string]json.RawMessage `json:"posts"`
+	NextCursor string                       `json:"next_cursor,omitempty"`
+	PrevCursor string                       `json:"prev_cursor,omitempty"`
 }
 
 type PostUpdateResponse struct {
@@ -28,16 +56,121 @@ type PostUpdateResponse struct {
 }
 
 type ListPostResponse struct {
-	Page  uint64         `json:"page"`
-	Posts []*models.Post `json:"posts"`
+	// Deprecated: only set when the page was requested with ?page=
+	Page       *uint64        `json:"page,omitempty"`
+	Posts      []*models.Post `json:"posts"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+	PrevCursor string         `json:"prev_cursor,omitempty"`
+}
+
+// findVisiblePost answers 404 unless the post exists and the caller may see
+// it. It returns nil once an error has been written.
+func findVisiblePost(w http.ResponseWriter, r *http.Request, id string) *models.Post {
+	post, err := repository.GetVisiblePost(r.Context(), id, callerId(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if post == nil {
+		http.Error(w, "post not found", http.StatusNotFound)
+		return nil
+	}
+	return post
+}
+
+// sendForPost pushes message to the sockets of the users who may see post:
+// everyone for public posts, the followers of the author for the posts
+// meant for them and for unlisted ones, and the author alone otherwise or
+// once the post is hidden. Whoever blocked, was blocked by or muted the
+// author or one of actorIds, such as a commenter, is left out.
+func sendForPost(ctx context.Context, s server.Server, post *models.Post, message models.WebsocketMessage, actorIds ...string) error {
+	if post.HiddenAt != nil {
+		s.Hub().SendToUsers([]string{post.UserId}, message)
+		return nil
+	}
+	senderIds := append([]string{post.UserId}, actorIds...)
+	if post.Status == models.POST_PUBLISHED && post.Visibility == models.VISIBILITY_PUBLIC {
+		s.Hub().BroadcastFrom(message, senderIds)
+		return nil
+	}
+
+	userIds := []string{post.UserId}
+	if post.Status == models.POST_PUBLISHED && post.Visibility != models.VISIBILITY_PRIVATE {
+		followers, err := repository.ListFollowers(ctx, post.UserId)
+		if err != nil {
+			return err
+		}
+		for _, follow := range followers {
+			userIds = append(userIds, follow.UserId)
+		}
+	}
+	s.Hub().SendToUsersFrom(userIds, senderIds, message)
+	return nil
+}
+
+func validatePostFormat(format string) error {
+	switch format {
+	case "", models.POST_FORMAT_PLAIN, models.POST_FORMAT_MARKDOWN:
+		return nil
+	}
+	return errors.New("format must be plain or markdown")
+}
+
+// resolve fills in the default status, visibility and format of a new post
+// and checks them.
+func (request *UpsertPostRequest) resolve() error {
+	status, err := resolvePostStatus(request.Status, request.PublishAt)
+	if err != nil {
+		return err
+	}
+	request.Status = status
+	if err := validatePostFormat(request.Format); err != nil {
+		return err
+	}
+	if request.Format == "" {
+		request.Format = models.POST_FORMAT_PLAIN
+	}
+	if request.Visibility == "" {
+		request.Visibility = models.VISIBILITY_PUBLIC
+	}
+	if !models.VISIBILITIES[request.Visibility] {
+		return errors.New("visibility must be public, unlisted, followers or private")
+	}
+	return nil
+}
+
+// resolvePostStatus checks that publishAt goes with status. A post with a
+// publish date and no status is scheduled, one with neither is published.
+func resolvePostStatus(status string, publishAt *time.Time) (string, error) {
+	if status == "" {
+		status = models.POST_PUBLISHED
+		if publishAt != nil {
+			status = models.POST_SCHEDULED
+		}
+	}
+	switch status {
+	case models.POST_DRAFT, models.POST_PUBLISHED:
+		if publishAt != nil {
+			return "", errors.New("publish_at is only allowed on scheduled posts")
+		}
+	case models.POST_SCHEDULED:
+		if publishAt == nil || !publishAt.After(time.Now()) {
+			return "", errors.New("scheduled posts need a publish_at in the future")
+		}
+	default:
+		return "", errors.New("status must be draft, scheduled or published")
+	}
+	return status, nil
 }
 
 func GetPostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		params := mux.Vars(r)
-		post, err := repository.GetPostById(r.Context(), params["id"])
-
-		if err != nil {
+		post := findVisiblePost(w, r, params["id"])
+		if post == nil {
+			return
+		}
+		if err := decoratePosts(r.Context(), s, []*models.Post{post}, callerId(r)); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -46,6 +179,69 @@ func GetPostHandler(s server.Server) http.HandlerFunc {
 	}
 }
 
+// createPost stores a new post for userId and announces it on the hub once
+// published. It is shared by the HTTP handler and the websocket frame
+// handler, which check the status of the request beforehand.
+func createPost(ctx context.Context, s server.Server, userId string, request UpsertPostRequest) (*models.Post, error) {
+	id, err := ksuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+	post := models.Post{
+		Id:          id.String(),
+		PostContent: request.PostContent,
+		Format:      request.Format,
+		UserId:      userId,
+		Status:      request.Status,
+		PublishAt:   request.PublishAt,
+		Visibility:  request.Visibility,
+	}
+	verdict, err := moderate(ctx, s, userId, "", post.PostContent)
+	if err != nil {
+		return nil, err
+	}
+	if post.PostHTML, err = utils.RenderPost(post.PostContent, post.Format); err != nil {
+		return nil, err
+	}
+
+	if err := repository.InsertPost(ctx, &post); err != nil {
+		return nil, err
+	}
+	if err := flagPost(ctx, post.Id, verdict); err != nil {
+		return nil, err
+	}
+	if post.Status == models.POST_PUBLISHED {
+		if err := announcePost(ctx, s, &post); err != nil {
+			return nil, err
+		}
+	}
+	return &post, nil
+}
+
+// announcePost indexes a newly published post and broadcasts it.
+func announcePost(ctx context.Context, s server.Server, post *models.Post) error {
+	if err := indexPost(ctx, s, post); err != nil {
+		return err
+	}
+
+	postMessage := models.WebsocketMessage{
+		Type:    "Post_Created",
+		Payload: post,
+	}
+
+	return sendForPost(ctx, s, post, postMessage)
+}
+
+// BindScheduledPosts announces the scheduled posts the scheduler publishes
+// the same way as posts published right away.
+func BindScheduledPosts(s server.Server) {
+	s.Scheduler().OnPublished(func(ctx context.Context, post *models.Post) {
+		if err := announcePost(ctx, s, post); err != nil {
+			log.Println("scheduler:", post.Id, err)
+		}
+	})
+}
+
 func InsertPostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
@@ -55,40 +251,122 @@ func InsertPostHandler(s server.Server) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		id, err := ksuid.NewRandom()
-
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err := postRequest.resolve(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		post := models.Post{
-			Id:          id.String(),
-			PostContent: postRequest.PostContent,
-			UserId:      claims.UserId,
-		}
 
-		if err := repository.InsertPost(r.Context(), &post); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		post, err := createPost(r.Context(), s, claims.UserId, postRequest)
+		if errors.Is(err, moderation.ErrRejected) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
 			return
 		}
-
-		postMessage := models.WebsocketMessage{
-			Type:    "Post_Created",
-			Payload: post,
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 
-		s.Hub().Broadcast(postMessage, nil)
-
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(&PostResponse{
 			Id:          post.Id,
 			PostContent: post.PostContent,
+			Format:      post.Format,
+			PostHTML:    post.PostHTML,
 		})
 
 	}
 
 }
 
+// updatePost changes the content of a post owned by userId. It is shared by
+// the HTTP handler and the websocket frame handler.
+func updatePost(ctx context.Context, s server.Server, userId string, id string, request UpsertPostRequest) (*models.Post, error) {
+	post := models.Post{
+		Id:          id,
+		PostContent: request.PostContent,
+		Format:      request.Format,
+		UserId:      userId,
+	}
+	if post.Format == "" {
+		current, err := repository.GetPostById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		post.Format = current.Format
+	}
+	verdict, err := moderate(ctx, s, userId, id, post.PostContent)
+	if err != nil {
+		return nil, err
+	}
+	if post.PostHTML, err = utils.RenderPost(post.PostContent, post.Format); err != nil {
+		return nil, err
+	}
+
+	if err := repository.UpdatePost(ctx, &post); err != nil {
+		return nil, err
+	}
+	if err := flagPost(ctx, post.Id, verdict); err != nil {
+		return nil, err
+	}
+	// drafts are indexed when published
+	if post.Status == models.POST_PUBLISHED {
+		if err := indexPost(ctx, s, &post); err != nil {
+			return nil, err
+		}
+	}
+	return &post, nil
+}
+
+// PostStatusHandler saves a post of the caller as a draft, schedules it or
+// publishes it right away. Published posts keep their status.
+func PostStatusHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+		var request = PostStatusRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if request.Status == "" {
+			http.Error(w, "status is required", http.StatusBadRequest)
+			return
+		}
+		status, err := resolvePostStatus(request.Status, request.PublishAt)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		post := models.Post{
+			Id:        params["id"],
+			UserId:    claims.UserId,
+			Status:    status,
+			PublishAt: request.PublishAt,
+		}
+		err = repository.SetPostStatus(r.Context(), &post)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrAlreadyPublished) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if post.Status == models.POST_PUBLISHED {
+			if err := announcePost(r.Context(), s, &post); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(&post)
+	}
+}
+
 func UpdatePostHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
@@ -98,13 +376,21 @@ func UpdatePostHandler(s server.Server) http.HandlerFunc {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		post := models.Post{
-			Id:          params["id"],
-			PostContent: postUpdate.PostContent,
-			UserId:      claims.UserId,
+		if err := validatePostFormat(postUpdate.Format); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		if err := repository.UpdatePost(r.Context(), &post); err != nil {
+		post, err := updatePost(r.Context(), s, claims.UserId, params["id"], postUpdate)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, moderation.ErrRejected) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -120,40 +406,138 @@ func DeletePostHanlder(s server.Server) http.HandlerFunc {
 		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
 		params := mux.Vars(r)
 
-		if err := repository.DeletePost(r.Context(), params["id"], claims.UserId); err != nil {
+		err := repository.DeletePost(r.Context(), params["id"], claims.UserId)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 
 		json.NewEncoder(w).Encode(&PostUpdateResponse{
-			Message: fmt.Sprintf("Post %s has been deleted", params["id"]),
+			Message: fmt.Sprintf("Post %s has been moved to the trash", params["id"]),
 		})
 	}
 }
 
+// PostVisibilityHandler changes who may see a post of the caller. Events
+// already pushed to sockets are not taken back.
+func PostVisibilityHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		var request = PostVisibilityRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !models.VISIBILITIES[request.Visibility] {
+			http.Error(w, "visibility must be public, unlisted, followers or private", http.StatusBadRequest)
+			return
+		}
+
+		post := models.Post{
+			Id:         mux.Vars(r)["id"],
+			UserId:     claims.UserId,
+			Visibility: request.Visibility,
+		}
+		err := repository.SetPostVisibility(r.Context(), &post)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&post)
+	}
+}
+
+// ListPostHanlder pages through the posts using the cursors returned with
+// each page. Posts can be filtered with user_id, created_after,
+// created_before and contains, sorted with sort=created_at or -created_at
+// (the default), and trimmed to the fields listed in fields. The ?page=
+// offset pagination is deprecated.
 func ListPostHanlder(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		pageStr := r.URL.Query().Get("page")
-		var page = uint64(0)
-		var err error
 		if pageStr != "" {
-			page, err = strconv.ParseUint(pageStr, 10, 64)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+			listPostPage(s, w, r, pageStr)
+			return
+		}
+
+		query, err := parsePostQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.ViewerId = callerId(r)
+		// drafts and scheduled posts are only listed to their author
+		if query.Status != "" && query.Status != models.POST_PUBLISHED {
+			if callerId(r) == "" {
+				http.Error(w, "authentication required", http.StatusUnauthorized)
 				return
 			}
+			query.UserId = callerId(r)
 		}
 
-		posts, err := repository.ListPost(r.Context(), page)
+		posts, err := repository.ListPost(r.Context(), query)
 
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		if err := decoratePosts(r.Context(), s, posts, callerId(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-		json.NewEncoder(w).Encode(&ListPostResponse{
-			Posts: posts,
-			Page:  page,
+		nextCursor, prevCursor := pageCursors(posts, query.Cursor, query.Limit)
+		if len(query.Fields) == 0 {
+			json.NewEncoder(w).Encode(&ListPostResponse{
+				Posts:      posts,
+				NextCursor: nextCursor,
+				PrevCursor: prevCursor,
+			})
+			return
+		}
+
+		sparsePosts, err := selectFields(posts, query.Fields)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&SparseListPostResponse{
+			Posts:      sparsePosts,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
 		})
 	}
 }
+
+func listPostPage(s server.Server, w http.ResponseWriter, r *http.Request, pageStr string) {
+	page, err := strconv.ParseUint(pageStr, 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts, err := repository.ListPostPage(r.Context(), page, callerId(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := decoratePosts(r.Context(), s, posts, callerId(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</api/v1/posts>; rel="successor-version"`)
+	json.NewEncoder(w).Encode(&ListPostResponse{
+		Posts: posts,
+		Page:  &page,
+	})
+}
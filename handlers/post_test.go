@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+// postRepository records the post queries and status changes of a test;
+// every other method panics.
+type postRepository struct {
+	repository.Repository
+	query    *models.PostQuery
+	saved    *models.Post
+	setError error
+}
+
+func (repo *postRepository) ListPost(ctx context.Context, query *models.PostQuery) ([]*models.Post, error) {
+	repo.query = query
+	return []*models.Post{}, nil
+}
+
+func (repo *postRepository) SetPostStatus(ctx context.Context, post *models.Post) error {
+	repo.saved = post
+	return repo.setError
+}
+
+func useRepository(t *testing.T, repo repository.Repository) {
+	t.Helper()
+	repository.SetRepository(repo)
+	t.Cleanup(func() { repository.SetRepository(nil) })
+}
+
+// signedIn adds the claims of userId to r, unless it is empty.
+func signedIn(r *http.Request, userId string) *http.Request {
+	if userId == "" {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), utils.CLAIMS_KEY, &models.AppClaims{UserId: userId}))
+}
+
+func TestResolvePostStatus(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	for name, test := range map[string]struct {
+		status    string
+		publishAt *time.Time
+		want      string
+		err       bool
+	}{
+		"default":                   {"", nil, models.POST_PUBLISHED, false},
+		"default with publish_at":   {"", &future, models.POST_SCHEDULED, false},
+		"default with past date":    {"", &past, "", true},
+		"draft":                     {models.POST_DRAFT, nil, models.POST_DRAFT, false},
+		"draft with publish_at":     {models.POST_DRAFT, &future, "", true},
+		"scheduled":                 {models.POST_SCHEDULED, &future, models.POST_SCHEDULED, false},
+		"scheduled in the past":     {models.POST_SCHEDULED, &past, "", true},
+		"scheduled without date":    {models.POST_SCHEDULED, nil, "", true},
+		"published":                 {models.POST_PUBLISHED, nil, models.POST_PUBLISHED, false},
+		"published with publish_at": {models.POST_PUBLISHED, &future, "", true},
+		"unknown":                   {"archived", nil, "", true},
+	} {
+		status, err := resolvePostStatus(test.status, test.publishAt)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: got %q, want an error", name, status)
+			}
+			continue
+		}
+		if err != nil || status != test.want {
+			t.Errorf("%s: got %q, %v, want %q", name, status, err, test.want)
+		}
+	}
+}
+
+func TestPostStatusHandler(t *testing.T) {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	for name, test := range map[string]struct {
+		body     string
+		setError error
+		code     int
+		saved    string
+	}{
+		"to draft":              {`{"status":"draft"}`, nil, http.StatusOK, models.POST_DRAFT},
+		"to scheduled":          {`{"status":"scheduled","publish_at":"` + future + `"}`, nil, http.StatusOK, models.POST_SCHEDULED},
+		"scheduled in the past": {`{"status":"scheduled","publish_at":"` + past + `"}`, nil, http.StatusBadRequest, ""},
+		"draft with publish_at": {`{"status":"draft","publish_at":"` + future + `"}`, nil, http.StatusBadRequest, ""},
+		"no status":             {`{}`, nil, http.StatusBadRequest, ""},
+		"unknown status":        {`{"status":"archived"}`, nil, http.StatusBadRequest, ""},
+		"already published":     {`{"status":"draft"}`, repository.ErrAlreadyPublished, http.StatusConflict, models.POST_DRAFT},
+		"someone else's post":   {`{"status":"draft"}`, repository.ErrNotFound, http.StatusNotFound, models.POST_DRAFT},
+	} {
+		repo := &postRepository{setError: test.setError}
+		useRepository(t, repo)
+		request := httptest.NewRequest(http.MethodPatch, "/posts/p1/status", strings.NewReader(test.body))
+		request = mux.SetURLVars(signedIn(request, "alice"), map[string]string{"id": "p1"})
+		recorder := httptest.NewRecorder()
+		PostStatusHandler(nil)(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: got %d, want %d", name, recorder.Code, test.code)
+		}
+		if test.saved == "" {
+			if repo.saved != nil {
+				t.Errorf("%s: the post was saved as %q", name, repo.saved.Status)
+			}
+			continue
+		}
+		if repo.saved == nil || repo.saved.Status != test.saved || repo.saved.UserId != "alice" || repo.saved.Id != "p1" {
+			t.Errorf("%s: saved %+v, want post p1 of alice %s", name, repo.saved, test.saved)
+		}
+	}
+}
+
+func TestListPostStatus(t *testing.T) {
+	for name, test := range map[string]struct {
+		caller string
+		query  string
+		code   int
+		userId string
+	}{
+		"published":                 {"", "?status=published&user_id=bob", http.StatusOK, "bob"},
+		"anonymous drafts":          {"", "?status=draft", http.StatusUnauthorized, ""},
+		"anonymous scheduled":       {"", "?status=scheduled", http.StatusUnauthorized, ""},
+		"own drafts":                {"alice", "?status=draft", http.StatusOK, "alice"},
+		"drafts of someone else":    {"alice", "?status=draft&user_id=bob", http.StatusOK, "alice"},
+		"scheduled of someone else": {"alice", "?status=scheduled&user_id=bob", http.StatusOK, "alice"},
+	} {
+		repo := &postRepository{}
+		useRepository(t, repo)
+		request := signedIn(httptest.NewRequest(http.MethodGet, "/posts"+test.query, nil), test.caller)
+		recorder := httptest.NewRecorder()
+		ListPostHanlder(nil)(recorder, request)
+
+		if recorder.Code != test.code {
+			t.Errorf("%s: got %d, want %d", name, recorder.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			if repo.query != nil {
+				t.Errorf("%s: posts were listed", name)
+			}
+			continue
+		}
+		if repo.query.UserId != test.userId || repo.query.ViewerId != test.caller {
+			t.Errorf("%s: listed the posts of %q to %q, want %q", name, repo.query.UserId, repo.query.ViewerId, test.userId)
+		}
+		var response ListPostResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+)
+
+type PresenceResponse struct {
+	Users []models.OnlineUser `json:"users"`
+}
+
+func PresenceHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		online, err := s.Hub().OnlineUsers()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hidden, err := repository.ListHiddenUsers(r.Context(), callerId(r))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		users := make([]models.OnlineUser, 0, len(online))
+		for _, user := range online {
+			if !containsString(hidden, user.UserId) {
+				users = append(users, user)
+			}
+		}
+		json.NewEncoder(w).Encode(&PresenceResponse{
+			Users: users,
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"log"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+)
+
+// BindLinkPreviews sends the previews of a post to whoever can see it once
+// they are fetched, as they come after the post itself.
+func BindLinkPreviews(s server.Server) {
+	s.Unfurler().OnUnfurled(func(postId string, previews []*models.LinkPreview) {
+		ctx := context.Background()
+		post, err := repository.GetPostById(ctx, postId)
+		if err != nil || post.Id == "" {
+			log.Println("unfurl:", postId, err)
+			return
+		}
+		if err := sendForPost(ctx, s, post, models.WebsocketMessage{
+			Type: models.POST_PREVIEWS,
+			Payload: models.LinkPreviewsPayload{
+				PostId:   postId,
+				Previews: previews,
+			},
+		}); err != nil {
+			log.Println("unfurl:", postId, err)
+		}
+	})
+}
+
+func attachPreviews(ctx context.Context, posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+
+	previews, err := repository.ListPostPreviews(ctx, postIds)
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		post.Previews = previews[post.Id]
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func parseTime(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, errors.New(name + " must be an RFC 3339 timestamp")
+	}
+	return &t, nil
+}
+
+// parsePostQuery builds the validated listing query from the URL.
+func parsePostQuery(r *http.Request) (*models.PostQuery, error) {
+	values := r.URL.Query()
+	query := models.PostQuery{
+		UserId:   values.Get("user_id"),
+		Status:   values.Get("status"),
+		Contains: values.Get("contains"),
+	}
+
+	var err error
+	if query.Limit, err = parseLimit(r); err != nil {
+		return nil, err
+	}
+	if query.Cursor, err = parseCursor(r); err != nil {
+		return nil, err
+	}
+	if query.CreatedAfter, err = parseTime(r, "created_after"); err != nil {
+		return nil, err
+	}
+	if query.CreatedBefore, err = parseTime(r, "created_before"); err != nil {
+		return nil, err
+	}
+
+	switch values.Get("sort") {
+	case "", "-created_at":
+	case "created_at":
+		query.Ascending = true
+	default:
+		return nil, errors.New("sort must be created_at or -created_at")
+	}
+
+	if fields := values.Get("fields"); fields != "" {
+		for _, field := range strings.Split(fields, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				query.Fields = append(query.Fields, field)
+			}
+		}
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+	return &query, nil
+}
+
+// selectFields keeps only the requested JSON fields of each post.
+func selectFields(posts []*models.Post, fields []string) ([]map[string]json.RawMessage, error) {
+	selected := make([]map[string]json.RawMessage, 0, len(posts))
+	for _, post := range posts {
+		data, err := json.Marshal(post)
+		if err != nil {
+			return nil, err
+		}
+		var all map[string]json.RawMessage
+		if err := json.Unmarshal(data, &all); err != nil {
+			return nil, err
+		}
+		sparse := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := all[field]; ok {
+				sparse[field] = value
+			}
+		}
+		selected = append(selected, sparse)
+	}
+	return selected, nil
+}
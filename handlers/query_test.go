@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func TestParsePostQuery(t *testing.T) {
+	after := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	for query, want := range map[string]models.PostQuery{
+		"": {Limit: DEFAULT_PAGE_SIZE},
+		"?user_id=u1&status=draft&contains=go&limit=5": {
+			UserId: "u1", Status: models.POST_DRAFT, Contains: "go", Limit: 5,
+		},
+		"?sort=created_at":  {Ascending: true, Limit: DEFAULT_PAGE_SIZE},
+		"?sort=-created_at": {Limit: DEFAULT_PAGE_SIZE},
+		"?created_after=2024-01-01T00:00:00Z&created_before=2024-02-01T00:00:00Z": {
+			CreatedAfter: &after, CreatedBefore: &before, Limit: DEFAULT_PAGE_SIZE,
+		},
+		"?fields=id,%20post_content,,created_at": {
+			Fields: []string{"id", "post_content", "created_at"}, Limit: DEFAULT_PAGE_SIZE,
+		},
+	} {
+		got, err := parsePostQuery(httptest.NewRequest("GET", "/posts"+query, nil))
+		if err != nil {
+			t.Errorf("parsePostQuery(%q): %v", query, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, want) {
+			t.Errorf("parsePostQuery(%q) = %+v, want %+v", query, *got, want)
+		}
+	}
+}
+
+func TestParsePostQueryRejects(t *testing.T) {
+	for query, message := range map[string]string{
+		"?limit=0":                   "invalid limit",
+		"?cursor=garbage":            "invalid cursor",
+		"?sort=popularity":           "sort must be",
+		"?sort=created_at,id":        "sort must be",
+		"?sort=-":                    "sort must be",
+		"?created_after=yesterday":   "created_after must be an RFC 3339 timestamp",
+		"?created_before=2024-01-01": "created_before must be an RFC 3339 timestamp",
+		"?status=deleted":            "status must be",
+		"?fields=id,password":        "unknown field password",
+		"?fields=ID":                 "unknown field ID",
+		"?contains=" + strings.Repeat("a", models.MAX_CONTAINS_LENGTH+1):          "contains is too long",
+		"?created_after=2024-02-01T00:00:00Z&created_before=2024-01-01T00:00:00Z": "created_after must be before",
+		"?created_after=2024-01-01T00:00:00Z&created_before=2024-01-01T00:00:00Z": "created_after must be before",
+	} {
+		_, err := parsePostQuery(httptest.NewRequest("GET", "/posts"+query, nil))
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("parsePostQuery(%q) = %v, want %q", query, err, message)
+		}
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	list := []*models.Post{
+		{Id: "a", UserId: "u1", PostContent: "hello", CreatedAt: created},
+		{Id: "b", UserId: "u2", PostContent: "world", CreatedAt: created},
+	}
+
+	selected, err := selectFields(list, []string{"id", "post_content", "created_at", "publish_at"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(selected)
+	want := `[{"created_at":"2024-01-01T00:00:00Z","id":"a","post_content":"hello"},` +
+		`{"created_at":"2024-01-01T00:00:00Z","id":"b","post_content":"world"}]`
+	if string(data) != want {
+		t.Errorf("got %s, want %s", data, want)
+	}
+
+	selected, err = selectFields([]*models.Post{}, []string{"id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := json.Marshal(selected); string(data) != "[]" {
+		t.Errorf("got %s for no posts", data)
+	}
+}
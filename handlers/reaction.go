@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+type ReactionResponse struct {
+	PostId    string            `json:"post_id"`
+	Kind      string            `json:"kind"`
+	Reactions map[string]uint64 `json:"reactions"`
+}
+
+// callerId returns the id of the authenticated caller, or an empty string on
+// public routes requested anonymously.
+func callerId(r *http.Request) string {
+	if claims, ok := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims); ok {
+		return claims.UserId
+	}
+	return ""
+}
+
+// attachReactions fills in the reaction counts of the posts and, when userId
+// is set, the reactions that user left.
+func attachReactions(ctx context.Context, posts []*models.Post, userId string) error {
+	if len(posts) == 0 {
+		return nil
+	}
+	postIds := make([]string, 0, len(posts))
+	for _, post := range posts {
+		postIds = append(postIds, post.Id)
+	}
+
+	counts, err := repository.GetReactionCounts(ctx, postIds)
+	if err != nil {
+		return err
+	}
+	var mine map[string][]string
+	if userId != "" {
+		if mine, err = repository.GetUserReactions(ctx, postIds, userId); err != nil {
+			return err
+		}
+	}
+
+	for _, post := range posts {
+		post.Reactions = counts[post.Id]
+		if post.Reactions == nil {
+			post.Reactions = map[string]uint64{}
+		}
+		post.MyReactions = mine[post.Id]
+	}
+	return nil
+}
+
+func changeReactionHandler(add bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+		if _, ok := models.REACTION_KINDS[params["kind"]]; !ok {
+			http.Error(w, "unknown reaction", http.StatusBadRequest)
+			return
+		}
+
+		post := findVisiblePost(w, r, params["id"])
+		if post == nil {
+			return
+		}
+
+		reaction := models.Reaction{
+			PostId: post.Id,
+			UserId: claims.UserId,
+			Kind:   params["kind"],
+		}
+		var err error
+		if add {
+			_, err = repository.AddReaction(r.Context(), &reaction)
+		} else {
+			_, err = repository.RemoveReaction(r.Context(), &reaction)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if err := attachReactions(r.Context(), []*models.Post{post}, ""); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ReactionResponse{
+			PostId:    post.Id,
+			Kind:      reaction.Kind,
+			Reactions: post.Reactions,
+		})
+	}
+}
+
+func PutReactionHandler(s server.Server) http.HandlerFunc {
+	return changeReactionHandler(true)
+}
+
+func DeleteReactionHandler(s server.Server) http.HandlerFunc {
+	return changeReactionHandler(false)
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/moderation"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+type ListRevisionsResponse struct {
+	Revisions []*models.PostRevision `json:"revisions"`
+}
+
+// ListPostRevisionsHandler returns every version of a post, newest first.
+func ListPostRevisionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		post := findVisiblePost(w, r, mux.Vars(r)["id"])
+		if post == nil {
+			return
+		}
+
+		revisions, err := repository.ListPostRevisions(r.Context(), post.Id)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&ListRevisionsResponse{Revisions: revisions})
+	}
+}
+
+// DiffPostRevisionsHandler compares revision from with revision to. They
+// default to the previous and the latest revisions.
+func DiffPostRevisionsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		post := findVisiblePost(w, r, mux.Vars(r)["id"])
+		if post == nil {
+			return
+		}
+		postId := post.Id
+		revisions, err := repository.ListPostRevisions(r.Context(), postId)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(revisions) == 0 {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+
+		latest := revisions[0].Revision
+		to, err := parseRevision(r.URL.Query().Get("to"), latest)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		from, err := parseRevision(r.URL.Query().Get("from"), to-1)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		contents := make(map[int]string, len(revisions))
+		for _, revision := range revisions {
+			contents[revision.Revision] = revision.PostContent
+		}
+		before, ok := contents[from]
+		if !ok && from != 0 {
+			http.Error(w, fmt.Sprintf("revision %d not found", from), http.StatusNotFound)
+			return
+		}
+		after, ok := contents[to]
+		if !ok {
+			http.Error(w, fmt.Sprintf("revision %d not found", to), http.StatusNotFound)
+			return
+		}
+
+		json.NewEncoder(w).Encode(&models.RevisionDiff{
+			PostId: postId,
+			From:   from,
+			To:     to,
+			Chunks: utils.Diff(before, after),
+		})
+	}
+}
+
+// parseRevision reads a revision number, 0 standing for the empty post
+// before the first revision.
+func parseRevision(value string, fallback int) (int, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	revision, err := strconv.Atoi(value)
+	if err != nil || revision < 0 {
+		return 0, fmt.Errorf("invalid revision %q", value)
+	}
+	return revision, nil
+}
+
+// RestorePostRevisionHandler makes the content of an earlier revision the
+// current one. The restore is itself recorded as a new revision.
+func RestorePostRevisionHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		params := mux.Vars(r)
+		number, err := strconv.Atoi(params["revision"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		revision, err := repository.GetPostRevision(r.Context(), params["id"], number)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if revision == nil {
+			http.Error(w, "revision not found", http.StatusNotFound)
+			return
+		}
+
+		post, err := updatePost(r.Context(), s, claims.UserId, revision.PostId, UpsertPostRequest{
+			PostContent: revision.PostContent,
+			Format:      revision.Format,
+		})
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "post not found", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, moderation.ErrRejected) {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(post)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+)
+
+type SearchPostsResponse struct {
+	Results    []*models.SearchResult `json:"results"`
+	NextOffset *uint64                `json:"next_offset,omitempty"`
+}
+
+// SearchPostsHandler ranks posts matching q. Results are paged with limit
+// and offset since a ranking has no stable cursor.
+func SearchPostsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, err := parseLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query := models.SearchQuery{
+			ViewerId: callerId(r),
+			Text:     r.URL.Query().Get("q"),
+			Limit:    limit,
+		}
+		if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+			if query.Offset, err = strconv.ParseUint(offsetStr, 10, 64); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := query.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		results, err := repository.SearchPosts(r.Context(), &query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		posts := make([]*models.Post, 0, len(results))
+		for _, result := range results {
+			posts = append(posts, result.Post)
+		}
+		if err := decoratePosts(r.Context(), s, posts, callerId(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		response := SearchPostsResponse{Results: results}
+		if next := query.Offset + query.Limit; uint64(len(results)) == query.Limit && next <= models.MAX_SEARCH_OFFSET {
+			response.NextOffset = &next
+		}
+		json.NewEncoder(w).Encode(&response)
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+const (
+	DEFAULT_TRENDING_WINDOW = 24 * time.Hour
+	MAX_TRENDING_WINDOW     = 30 * 24 * time.Hour
+	TRENDING_TAGS_LIMIT     = 10
+)
+
+type TrendingTagsResponse struct {
+	Since time.Time          `json:"since"`
+	Tags  []*models.TagCount `json:"tags"`
+}
+
+// indexPost stores the tags and mentions found in the post content, queues
+// its links for unfurling and notifies the users mentioned for the first
+// time.
+func indexPost(ctx context.Context, s server.Server, post *models.Post) error {
+	if err := repository.ReplacePostTags(ctx, post.Id, utils.ExtractTags(post.PostContent)); err != nil {
+		return err
+	}
+
+	userIds := make([]string, 0)
+	if handles := utils.ExtractMentions(post.PostContent); len(handles) > 0 {
+		users, err := repository.GetUsersByHandles(ctx, handles)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			if user.Id != post.UserId {
+				userIds = append(userIds, user.Id)
+			}
+		}
+	}
+
+	mentioned, err := repository.ReplacePostMentions(ctx, post.Id, userIds)
+	if err != nil {
+		return err
+	}
+	s.Unfurler().Enqueue(post)
+
+	excluded, err := repository.ListExcludedUsers(ctx, post.UserId)
+	if err != nil {
+		return err
+	}
+	for _, userId := range mentioned {
+		if containsString(excluded, userId) {
+			continue
+		}
+		// users who cannot see the post are not told about it
+		visible, err := repository.GetVisiblePost(ctx, post.Id, userId)
+		if err != nil {
+			return err
+		}
+		if visible == nil {
+			continue
+		}
+		s.Hub().SendToUser(userId, models.WebsocketMessage{
+			Type: models.MENTION_CREATED,
+			Payload: models.MentionPayload{
+				PostId:   post.Id,
+				AuthorId: post.UserId,
+			},
+		})
+	}
+	return nil
+}
+
+func TagPostsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, err := parsePostQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Tag = strings.ToLower(mux.Vars(r)["tag"])
+		// only published posts are tagged
+		query.Status = models.POST_PUBLISHED
+		query.ViewerId = callerId(r)
+
+		posts, err := repository.ListPost(r.Context(), query)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := decoratePosts(r.Context(), s, posts, callerId(r)); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		nextCursor, prevCursor := pageCursors(posts, query.Cursor, query.Limit)
+		json.NewEncoder(w).Encode(&ListPostResponse{
+			Posts:      posts,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		})
+	}
+}
+
+// TrendingTagsHandler ranks the tags used within the window, a duration such
+// as 6h, ending now.
+func TrendingTagsHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		window := DEFAULT_TRENDING_WINDOW
+		if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+			var err error
+			window, err = time.ParseDuration(windowStr)
+			if err != nil || window <= 0 || window > MAX_TRENDING_WINDOW {
+				http.Error(w, "invalid window", http.StatusBadRequest)
+				return
+			}
+		}
+
+		since := time.Now().Add(-window)
+		tags, err := repository.TrendingTags(r.Context(), since, TRENDING_TAGS_LIMIT)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&TrendingTagsResponse{
+			Since: since,
+			Tags:  tags,
+		})
+	}
+}
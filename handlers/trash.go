@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+	"github.com/gorilla/mux"
+)
+
+// TrashHandler lists the posts the caller deleted that can still be
+// restored, newest first.
+func TrashHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		limit, err := parseLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursor, err := parseCursor(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if cursor != nil && cursor.Backward {
+			http.Error(w, "the trash only pages forward", http.StatusBadRequest)
+			return
+		}
+
+		posts, err := repository.ListTrash(r.Context(), claims.UserId, cursor, limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := decoratePosts(r.Context(), s, posts, claims.UserId); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		nextCursor, _ := pageCursors(posts, cursor, limit)
+		json.NewEncoder(w).Encode(&ListPostResponse{
+			Posts:      posts,
+			NextCursor: nextCursor,
+		})
+	}
+}
+
+// RestorePostHandler takes a post of the caller out of the trash, as long as
+// it has not been there longer than models.POST_TRASH_RETENTION.
+func RestorePostHandler(s server.Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+		post := models.Post{
+			Id:     mux.Vars(r)["id"],
+			UserId: claims.UserId,
+		}
+
+		err := repository.RestorePost(r.Context(), &post)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(w, "post not found in the trash", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(&post)
+	}
+}
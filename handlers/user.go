@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"github.com/adrisongomez/project-go/models"
 	"github.com/adrisongomez/project-go/repository"
@@ -19,11 +20,14 @@ const (
 type SignUpAndLoginRequest struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	// optional at signup, used to @mention the user
+	Handle string `json:"handle,omitempty"`
 }
 
 type SignUpAndMeResponse struct {
-	Id    string `json:"id"`
-	Email string `json:"email"`
+	Id     string `json:"id"`
+	Email  string `json:"email"`
+	Handle string `json:"handle,omitempty"`
 }
 
 type LoginResponse struct {
@@ -39,6 +43,11 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 			return
 		}
 
+		if request.Handle != "" && !utils.HandlePattern.MatchString(request.Handle) {
+			http.Error(w, "handle must be 3 to 32 letters, digits or underscores", http.StatusBadRequest)
+			return
+		}
+
 		hashedPassword, error := utils.HashText(request.Password)
 		if error != nil {
 			http.Error(w, "Error can be processed", http.StatusInternalServerError)
@@ -54,6 +63,7 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 			Email:    request.Email,
 			Password: *hashedPassword,
 			Id:       id.String(),
+			Handle:   strings.ToLower(request.Handle),
 		}
 
 		err := repository.InsertUser(r.Context(), &user)
@@ -62,6 +72,10 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 			if pqErr, ok := err.(*pq.Error); ok {
 				switch pqErr.Code.Name() {
 				case "unique_violation":
+					if pqErr.Constraint == "handle_unique" {
+						http.Error(w, "Handle is being used!", http.StatusForbidden)
+						return
+					}
 					http.Error(w, "Email is being used!", http.StatusForbidden)
 					return
 				default:
@@ -73,8 +87,9 @@ func SignUpHandler(s server.Server) http.HandlerFunc {
 		}
 
 		json.NewEncoder(w).Encode(SignUpAndMeResponse{
-			Id:    user.Id,
-			Email: user.Email,
+			Id:     user.Id,
+			Email:  user.Email,
+			Handle: user.Handle,
 		})
 	}
 }
@@ -121,8 +136,9 @@ func MeHandler(s server.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := r.Context().Value(utils.USER_KEY).(*models.User)
 		json.NewEncoder(w).Encode(SignUpAndMeResponse{
-			Id:    user.Id,
-			Email: user.Email,
+			Id:     user.Id,
+			Email:  user.Email,
+			Handle: user.Handle,
 		})
 
 	}
@@ -5,10 +5,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/adrisongomez/project-go/handlers"
 	"github.com/adrisongomez/project-go/middleware"
 	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/storage"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 )
@@ -23,11 +26,39 @@ func main() {
 	PORT := os.Getenv("PORT")
 	SECRET := os.Getenv("JWT_SECRET")
 	DB_URL := os.Getenv("DATABASE_URL")
+	TIMELINE_STRATEGY := os.Getenv("TIMELINE_STRATEGY")
+	STORAGE_DRIVER := os.Getenv("STORAGE_DRIVER")
+	STORAGE_PATH := os.Getenv("STORAGE_PATH")
+	MODERATION_FILTER := os.Getenv("MODERATION_FILTER")
+	var MODERATOR_IDS []string
+	if ids := os.Getenv("MODERATOR_IDS"); ids != "" {
+		MODERATOR_IDS = strings.Split(ids, ",")
+	}
+	var AUTO_HIDE_REPORTS int
+	if reports := os.Getenv("AUTO_HIDE_REPORTS"); reports != "" {
+		if AUTO_HIDE_REPORTS, err = strconv.Atoi(reports); err != nil {
+			log.Fatal("AUTO_HIDE_REPORTS must be a number")
+		}
+	}
 
 	s, error := server.NewServer(context.Background(), &server.Config{
-		Port:        PORT,
-		DatabaseURL: DB_URL,
-		JwtSecret:   SECRET,
+		Port:             PORT,
+		DatabaseURL:      DB_URL,
+		JwtSecret:        SECRET,
+		BlobSecret:       os.Getenv("BLOB_SIGNING_SECRET"),
+		TimelineStrategy: TIMELINE_STRATEGY,
+		StorageDriver:    STORAGE_DRIVER,
+		StoragePath:      STORAGE_PATH,
+		S3: storage.S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		},
+		ModeratorIds:    MODERATOR_IDS,
+		FilterPath:      MODERATION_FILTER,
+		AutoHideReports: AUTO_HIDE_REPORTS,
 	})
 
 	if error != nil {
@@ -38,16 +69,71 @@ func main() {
 		api := r.PathPrefix("/api/v1").Subrouter()
 		api.Use(middleware.CheckAuthMiddleware(s))
 		r.Use(middleware.ResponseFormat(s))
+		r.Use(middleware.OptionalAuthMiddleware(s))
 		r.HandleFunc("/", handlers.HomeHandler(s)).Methods(http.MethodGet)
 		r.HandleFunc("/signup", handlers.SignUpHandler(s)).Methods(http.MethodPost)
 		r.HandleFunc("/login", handlers.LoginHandler(s)).Methods(http.MethodPost)
 		api.HandleFunc("/me", handlers.MeHandler(s)).Methods(http.MethodGet)
 		r.HandleFunc("/api/v1/posts", handlers.ListPostHanlder(s)).Methods(http.MethodGet)
 		api.HandleFunc("/posts", handlers.InsertPostHandler(s)).Methods(http.MethodPost)
-		r.HandleFunc("api/v1/posts/{id}", handlers.GetPostHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/posts/{id}", handlers.GetPostHandler(s)).Methods(http.MethodGet)
 		api.HandleFunc("/posts/{id}", handlers.UpdatePostHandler(s)).Methods(http.MethodPut)
 		api.HandleFunc("/posts/{id}", handlers.DeletePostHanlder(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/posts/{id}/status", handlers.PostStatusHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/posts/{id}/visibility", handlers.PostVisibilityHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/posts/{id}/restore", handlers.RestorePostHandler(s)).Methods(http.MethodPost)
+		api.HandleFunc("/trash", handlers.TrashHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/posts/{id}/revisions", handlers.ListPostRevisionsHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/posts/{id}/revisions/diff", handlers.DiffPostRevisionsHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/posts/{id}/revisions/{revision:[0-9]+}/restore", handlers.RestorePostRevisionHandler(s)).Methods(http.MethodPost)
+		r.HandleFunc("/api/v1/posts/{id}/comments", handlers.ListCommentsHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/posts/{id}/comments", handlers.InsertCommentHandler(s)).Methods(http.MethodPost)
+		api.HandleFunc("/comments/{id}", handlers.UpdateCommentHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/comments/{id}", handlers.DeleteCommentHandler(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/posts/{id}/reactions/{kind}", handlers.PutReactionHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/posts/{id}/reactions/{kind}", handlers.DeleteReactionHandler(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/users/{id}/follow", handlers.FollowHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/users/{id}/follow", handlers.UnfollowHandler(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/users/{id}/block", handlers.BlockHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/users/{id}/block", handlers.UnblockHandler(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/users/{id}/mute", handlers.MuteHandler(s)).Methods(http.MethodPut)
+		api.HandleFunc("/users/{id}/mute", handlers.UnmuteHandler(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/blocks", handlers.ListBlocksHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/mutes", handlers.ListMutesHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/users/{id}/followers", handlers.ListFollowersHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/users/{id}/following", handlers.ListFollowingHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/timeline", handlers.TimelineHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/search/posts", handlers.SearchPostsHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/tags/trending", handlers.TrendingTagsHandler(s)).Methods(http.MethodGet)
+		r.HandleFunc("/api/v1/tags/{tag}/posts", handlers.TagPostsHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/posts/{id}/attachments", handlers.UploadAttachmentHandler(s)).Methods(http.MethodPost)
+		r.HandleFunc("/api/v1/attachments/{id}", handlers.GetAttachmentHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/attachments/{id}", handlers.DeleteAttachmentHandler(s)).Methods(http.MethodDelete)
+		api.HandleFunc("/posts/{id}/reports", handlers.ReportPostHandler(s)).Methods(http.MethodPost)
+		admin := api.PathPrefix("/admin").Subrouter()
+		admin.Use(middleware.RequireModeratorMiddleware(s))
+		admin.HandleFunc("/reports", handlers.ListReportsHandler(s)).Methods(http.MethodGet)
+		admin.HandleFunc("/reports/{id}/resolve", handlers.ResolveReportHandler(s)).Methods(http.MethodPost)
+		admin.HandleFunc("/reports/{id}/dismiss", handlers.DismissReportHandler(s)).Methods(http.MethodPost)
+		admin.HandleFunc("/audit", handlers.ModerationLogHandler(s)).Methods(http.MethodGet)
+		if local, ok := s.Storage().(*storage.LocalBlobStore); ok {
+			r.PathPrefix(server.BLOBS_PATH + "/").Handler(http.StripPrefix(server.BLOBS_PATH, local))
+		}
+		handlers.BindFrameHandlers(s)
+		handlers.BindBlocks(s)
+		handlers.BindMessageDeliveries(s)
+		handlers.BindAttachmentEvents(s)
+		handlers.BindScheduledPosts(s)
+		handlers.BindLinkPreviews(s)
 		r.HandleFunc("/ws", s.Hub().HandleWebSocket)
+		api.HandleFunc("/ws", s.Hub().HandleWebSocket)
+		api.HandleFunc("/events", s.Hub().HandleEventStream).Methods(http.MethodGet)
+		api.HandleFunc("/presence", handlers.PresenceHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/conversations", handlers.ListConversationsHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/conversations", handlers.CreateConversationHandler(s)).Methods(http.MethodPost)
+		api.HandleFunc("/conversations/{id}/messages", handlers.ListMessagesHandler(s)).Methods(http.MethodGet)
+		api.HandleFunc("/conversations/{id}/messages", handlers.InsertMessageHandler(s)).Methods(http.MethodPost)
+		api.HandleFunc("/conversations/{id}/read", handlers.ReadConversationHandler(s)).Methods(http.MethodPost)
 	}
 
 	s.Start(bindRoutes)
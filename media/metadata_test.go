@@ -0,0 +1,372 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// exifSegment is the payload of an APP1 segment whose first IFD holds an
+// orientation tag, preceded by another tag.
+func exifSegment(order binary.ByteOrder, orientation uint16) string {
+	tiff := make([]byte, 8+2+2*12+4)
+	if order == binary.LittleEndian {
+		copy(tiff, "II")
+	} else {
+		copy(tiff, "MM")
+	}
+	order.PutUint16(tiff[2:], 42)
+	order.PutUint32(tiff[4:], 8)
+	order.PutUint16(tiff[8:], 2)
+	// ImageWidth, then Orientation as a SHORT
+	order.PutUint16(tiff[10:], 0x0100)
+	order.PutUint16(tiff[12:], 3)
+	order.PutUint32(tiff[14:], 1)
+	order.PutUint16(tiff[18:], 640)
+	order.PutUint16(tiff[22:], EXIF_ORIENTATION_TAG)
+	order.PutUint16(tiff[24:], 3)
+	order.PutUint32(tiff[26:], 1)
+	order.PutUint16(tiff[30:], orientation)
+	return "Exif\x00\x00" + string(tiff)
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestStripJPEG(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	jfif := jpegSegment(0xE0, "JFIF\x00\x01\x01")
+	icc := jpegSegment(0xE2, "ICC_PROFILE\x00\x01\x01profile")
+	quantization := jpegSegment(0xDB, "\x00tables")
+	scan := concat(jpegSegment(0xDA, "\x01\x01\x00"), []byte("entropy \xFF\x00 coded\xFF\xD9"))
+
+	data := concat(
+		soi,
+		jfif,
+		jpegSegment(0xE1, exifSegment(binary.BigEndian, 6)),
+		jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta/>"),
+		icc,
+		jpegSegment(0xED, "Photoshop 3.0\x00iptc"),
+		[]byte{0xFF},
+		jpegSegment(0xFE, "a comment"),
+		quantization,
+		scan,
+	)
+	stripped, orientation, err := stripJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := concat(soi, jfif, icc, quantization, scan); !bytes.Equal(stripped, want) {
+		t.Errorf("got % x\nwant % x", stripped, want)
+	}
+	if orientation != 6 {
+		t.Errorf("orientation %d, want 6", orientation)
+	}
+}
+
+func TestStripJPEGKeepsImageDecodable(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 16, 8)), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := concat(encoded.Bytes()[:2], jpegSegment(0xE1, exifSegment(binary.LittleEndian, 8)), encoded.Bytes()[2:])
+
+	stripped, orientation, err := stripJPEG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if orientation != 8 {
+		t.Errorf("orientation %d, want 8", orientation)
+	}
+	if !bytes.Equal(stripped, encoded.Bytes()) {
+		t.Error("the exif segment was not the only one removed")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStripJPEGRejectsMalformed(t *testing.T) {
+	soi := []byte{0xFF, 0xD8}
+	for name, data := range map[string][]byte{
+		"empty":              {},
+		"not a jpeg":         []byte("GIF89a..."),
+		"segment too long":   concat(soi, []byte{0xFF, 0xE1, 0xFF, 0xFF}, []byte("Exif")),
+		"segment too short":  concat(soi, []byte{0xFF, 0xE1, 0x00, 0x01, 0x00, 0x00}),
+		"missing marker":     concat(soi, []byte{0x00, 0xE1, 0x00, 0x02}),
+		"truncated segment":  concat(soi, jpegSegment(0xE0, "JFIF\x00")[:6]),
+		"truncated after ff": concat(soi, jpegSegment(0xE0, "JFIF\x00"), []byte{0xFF, 0xE1, 0x00, 0x10, 'E'}),
+	} {
+		if _, _, err := stripJPEG(data); err != errMalformedJPEG {
+			t.Errorf("%s: got %v, want errMalformedJPEG", name, err)
+		}
+	}
+}
+
+func TestExifOrientation(t *testing.T) {
+	valid := exifSegment(binary.LittleEndian, 3)
+	for name, test := range map[string]struct {
+		segment string
+		want    int
+	}{
+		"little endian":      {exifSegment(binary.LittleEndian, 3), 3},
+		"big endian":         {exifSegment(binary.BigEndian, 7), 7},
+		"zero":               {exifSegment(binary.BigEndian, 0), 0},
+		"out of range":       {exifSegment(binary.LittleEndian, 9), 0},
+		"way out of range":   {exifSegment(binary.BigEndian, 0xFFFF), 0},
+		"not exif":           {"http://ns.adobe.com/xap/1.0/\x00", 0},
+		"unknown byte order": {"Exif\x00\x00XX" + valid[8:], 0},
+		"truncated header":   {valid[:10], 0},
+		"truncated entries":  {valid[:len(valid)-12], 0},
+		"offset past end":    {valid[:10] + "\xFF\xFF\xFF\x7F" + valid[14:], 0},
+		"offset in header":   {valid[:10] + "\x02\x00\x00\x00" + valid[14:], 0},
+		"count past the end": {valid[:14] + "\xFF\xFF" + valid[16:], 3},
+	} {
+		if got := exifOrientation([]byte(test.segment)); got != test.want {
+			t.Errorf("%s: got %d, want %d", name, got, test.want)
+		}
+	}
+}
+
+func pngChunk(kind string, data string) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, data...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+func TestStripPNG(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewNRGBA(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	// the signature and the IHDR chunk, then the rest of the image
+	header := encoded.Bytes()[:8+12+13]
+	rest := encoded.Bytes()[len(header):]
+	icc := pngChunk("iCCP", "profile\x00\x00compressed")
+	physical := pngChunk("pHYs", "\x00\x00\x0b\x13\x00\x00\x0b\x13\x01")
+
+	data := concat(
+		header,
+		pngChunk("eXIf", "MM\x00\x2a"),
+		icc,
+		pngChunk("tEXt", "Author\x00someone"),
+		pngChunk("iTXt", "Comment\x00\x00\x00\x00\x00secret"),
+		pngChunk("zTXt", "Location\x00\x00compressed"),
+		pngChunk("tIME", "\x07\xe8\x01\x01\x00\x00\x00"),
+		physical,
+		rest,
+	)
+	stripped, err := stripPNG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := concat(header, icc, physical, rest); !bytes.Equal(stripped, want) {
+		t.Errorf("got % x\nwant % x", stripped, want)
+	}
+	if _, err := png.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStripPNGRejectsMalformed(t *testing.T) {
+	signature := string(pngSignature)
+	for name, data := range map[string]string{
+		"empty":           "",
+		"not a png":       "\xFF\xD8\xFF\xE0",
+		"chunk too long":  signature + "\x00\x00\x10\x00tEXt" + "short",
+		"length overflow": signature + "\xFF\xFF\xFF\xFFtEXtdatacrc!",
+		"truncated crc":   signature + string(pngChunk("tEXt", "a\x00b")[:12]),
+	} {
+		if _, err := stripPNG([]byte(data)); err != errMalformedPNG {
+			t.Errorf("%s: got %v, want errMalformedPNG", name, err)
+		}
+	}
+}
+
+func riffChunk(kind string, data string) []byte {
+	chunk := make([]byte, 8, 8+len(data)+1)
+	copy(chunk, kind)
+	binary.LittleEndian.PutUint32(chunk[4:], uint32(len(data)))
+	chunk = append(chunk, data...)
+	if len(data)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+func webp(chunks ...[]byte) []byte {
+	body := concat(chunks...)
+	header := make([]byte, 12)
+	copy(header, "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(body)+4))
+	copy(header[8:], "WEBP")
+	return concat(header, body)
+}
+
+func TestStripWebP(t *testing.T) {
+	// icc, alpha, exif and xmp flags, then a 1x1 canvas
+	const flags = 0x20 | 0x10 | 0x08 | 0x04
+	vp8x := "\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+	icc := riffChunk("ICCP", "profile")
+	alpha := riffChunk("ALPH", "\x00alpha")
+	frame := riffChunk("VP8 ", "odd frame")
+
+	data := webp(
+		riffChunk("VP8X", string(rune(flags))+vp8x[1:]),
+		icc,
+		riffChunk("EXIF", "MM\x00\x2aexif"),
+		alpha,
+		frame,
+		riffChunk("XMP ", "<x:xmpmeta/>"),
+	)
+	stripped, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := webp(riffChunk("VP8X", "\x30"+vp8x[1:]), icc, alpha, frame)
+	if !bytes.Equal(stripped, want) {
+		t.Errorf("got % x\nwant % x", stripped, want)
+	}
+	if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+		t.Errorf("riff size %d, want %d", size, len(stripped)-8)
+	}
+	if data[20] != flags {
+		t.Error("the flags of the input were changed")
+	}
+}
+
+func TestStripWebPRejectsMalformed(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"empty":           {},
+		"not riff":        []byte("RIFX\x00\x00\x00\x00WEBP"),
+		"not webp":        []byte("RIFF\x04\x00\x00\x00WAVE"),
+		"chunk too long":  concat([]byte("RIFF\x00\x00\x00\x00WEBP"), []byte("EXIF\x00\x01\x00\x00exif")),
+		"length overflow": concat([]byte("RIFF\x00\x00\x00\x00WEBP"), []byte("EXIF\xFF\xFF\xFF\xFFexif")),
+		"missing padding": concat([]byte("RIFF\x00\x00\x00\x00WEBP"), riffChunk("VP8 ", "odd")[:11]),
+	} {
+		if _, err := stripWebP(data); err != errMalformedWebP {
+			t.Errorf("%s: got %v, want errMalformedWebP", name, err)
+		}
+	}
+}
+
+func TestStripMetadataKeepsGIF(t *testing.T) {
+	data := []byte("GIF89a...")
+	stripped, orientation, err := stripMetadata("image/gif", data)
+	if err != nil || !bytes.Equal(stripped, data) || orientation != 1 {
+		t.Errorf("got %q, %d, %v", stripped, orientation, err)
+	}
+}
+
+// grid is a 3x2 image whose pixels are numbered
+//
+//	1 2 3
+//	4 5 6
+func grid() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		img.SetNRGBA(i%3, i/3, color.NRGBA{R: uint8(i + 1), A: 255})
+	}
+	return img
+}
+
+func pixels(img image.Image) [][]uint8 {
+	bounds := img.Bounds()
+	rows := make([][]uint8, bounds.Dy())
+	for y := range rows {
+		rows[y] = make([]uint8, bounds.Dx())
+		for x := range rows[y] {
+			rows[y][x] = color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA).R
+		}
+	}
+	return rows
+}
+
+func TestOrient(t *testing.T) {
+	for orientation, want := range map[int][][]uint8{
+		0: {{1, 2, 3}, {4, 5, 6}},
+		1: {{1, 2, 3}, {4, 5, 6}},
+		// mirrored horizontally
+		2: {{3, 2, 1}, {6, 5, 4}},
+		// rotated 180°
+		3: {{6, 5, 4}, {3, 2, 1}},
+		// mirrored vertically
+		4: {{4, 5, 6}, {1, 2, 3}},
+		// transposed
+		5: {{1, 4}, {2, 5}, {3, 6}},
+		// rotated 90° clockwise
+		6: {{4, 1}, {5, 2}, {6, 3}},
+		// transversed
+		7: {{6, 3}, {5, 2}, {4, 1}},
+		// rotated 90° counterclockwise
+		8: {{3, 6}, {2, 5}, {1, 4}},
+		9: {{1, 2, 3}, {4, 5, 6}},
+	} {
+		got := pixels(orient(grid(), orientation))
+		if !equalPixels(got, want) {
+			t.Errorf("orientation %d: got %v, want %v", orientation, got, want)
+		}
+	}
+}
+
+func TestOrientSubImage(t *testing.T) {
+	// an image whose bounds do not start at the origin
+	img := image.NewNRGBA(image.Rect(0, 0, 5, 4))
+	copyGrid := grid()
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 3; x++ {
+			img.Set(x+1, y+1, copyGrid.At(x, y))
+		}
+	}
+	sub := img.SubImage(image.Rect(1, 1, 4, 3))
+	if got, want := pixels(orient(sub, 6)), [][]uint8{{4, 1}, {5, 2}, {6, 3}}; !equalPixels(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func equalPixels(a, b [][]uint8) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFit(t *testing.T) {
+	for _, test := range []struct {
+		width, height int
+		size          int
+		want          image.Point
+	}{
+		{400, 100, 100, image.Pt(100, 25)},
+		{100, 400, 100, image.Pt(25, 100)},
+		{300, 300, 150, image.Pt(150, 150)},
+		{1000, 1, 100, image.Pt(100, 1)},
+		{80, 60, 100, image.Pt(80, 60)},
+		{100, 100, 100, image.Pt(100, 100)},
+	} {
+		img := image.NewNRGBA(image.Rect(0, 0, test.width, test.height))
+		got := fit(img, test.size).Bounds().Size()
+		if got != test.want {
+			t.Errorf("fit(%dx%d, %d) = %v, want %v", test.width, test.height, test.size, got, test.want)
+		}
+	}
+}
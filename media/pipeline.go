@@ -0,0 +1,221 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"io"
+	"log"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/storage"
+)
+
+const (
+	MEDIA_WORKERS    = 2
+	MEDIA_QUEUE_SIZE = 256
+	MEDIA_TIMEOUT    = 2 * time.Minute
+	// the original is re-encoded at this quality when it has to be rotated
+	ORIGINAL_JPEG_QUALITY = 92
+	// where uploads wait for processing; nothing under it is ever signed
+	UPLOADS_PREFIX = "uploads/"
+)
+
+// errProcessed is returned when another worker finished the attachment and
+// removed its upload already.
+var errProcessed = errors.New("already processed")
+
+type variantSpec struct {
+	Name string
+	// longest side, in pixels
+	Size int
+}
+
+var VARIANTS = []variantSpec{
+	{Name: "thumbnail", Size: 200},
+	{Name: "medium", Size: 800},
+}
+
+// UploadKey is where the upload of an attachment stored at storageKey waits,
+// metadata included, until it is processed.
+func UploadKey(storageKey string) string {
+	return UPLOADS_PREFIX + storageKey
+}
+
+// CanProcess tells whether attachments of contentType get variants.
+func CanProcess(contentType string) bool {
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// Pipeline strips metadata from uploaded images and generates their resized
+// variants in the background.
+type Pipeline struct {
+	store       storage.BlobStore
+	jobs        chan *models.Attachment
+	onProcessed func(attachment *models.Attachment)
+}
+
+func NewPipeline(store storage.BlobStore) *Pipeline {
+	return &Pipeline{
+		store: store,
+		jobs:  make(chan *models.Attachment, MEDIA_QUEUE_SIZE),
+	}
+}
+
+// OnProcessed registers the function called once an attachment is ready or
+// has failed. It must be set before the pipeline runs.
+func (p *Pipeline) OnProcessed(onProcessed func(attachment *models.Attachment)) {
+	p.onProcessed = onProcessed
+}
+
+// Run starts the workers and queues the attachments left processing by a
+// previous run. Processing is idempotent, so replicas picking up the same
+// attachment only repeat work.
+func (p *Pipeline) Run(workers int) {
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	go func() {
+		attachments, err := repository.ListProcessingAttachments(context.Background())
+		if err != nil {
+			log.Println("media:", err)
+			return
+		}
+		for _, attachment := range attachments {
+			p.Enqueue(attachment)
+		}
+	}()
+}
+
+// Enqueue schedules attachment for processing. When the queue is full the
+// attachment stays processing until the next run picks it up.
+func (p *Pipeline) Enqueue(attachment *models.Attachment) {
+	job := *attachment
+	select {
+	case p.jobs <- &job:
+	default:
+		log.Println("media: queue is full, postponing", attachment.Id)
+	}
+}
+
+func (p *Pipeline) work() {
+	for attachment := range p.jobs {
+		ctx, cancel := context.WithTimeout(context.Background(), MEDIA_TIMEOUT)
+		err := p.process(ctx, attachment)
+		cancel()
+		if errors.Is(err, errProcessed) {
+			continue
+		}
+		if err != nil {
+			log.Println("media:", attachment.Id, err)
+			p.discard(attachment)
+		}
+		if p.onProcessed != nil {
+			p.onProcessed(attachment)
+		}
+	}
+}
+
+// discard marks a failed attachment and removes what was stored for it, the
+// upload with its metadata first.
+func (p *Pipeline) discard(attachment *models.Attachment) {
+	ctx := context.Background()
+	attachment.Status = models.ATTACHMENT_STATUS_FAILED
+	if err := repository.SetAttachmentStatus(ctx, attachment.Id, attachment.Status); err != nil {
+		log.Println("media:", attachment.Id, err)
+	}
+	keys := []string{UploadKey(attachment.StorageKey), attachment.StorageKey}
+	for _, variant := range attachment.Variants {
+		keys = append(keys, variant.StorageKey)
+	}
+	for _, key := range keys {
+		if err := p.store.Delete(ctx, key); err != nil {
+			log.Println("media:", key, err)
+		}
+	}
+}
+
+// process stores the upload without its metadata under the storage key of
+// the attachment, along with the variants, then removes the upload.
+func (p *Pipeline) process(ctx context.Context, attachment *models.Attachment) error {
+	data, err := p.read(ctx, UploadKey(attachment.StorageKey))
+	if err != nil {
+		current, getErr := repository.GetAttachmentById(ctx, attachment.Id)
+		if getErr == nil && current != nil && current.Status != models.ATTACHMENT_STATUS_PROCESSING {
+			return errProcessed
+		}
+		return err
+	}
+
+	stripped, orientation, err := stripMetadata(attachment.ContentType, data)
+	if err != nil {
+		return err
+	}
+	img, err := decode(stripped)
+	if err != nil {
+		return err
+	}
+	if orientation > 1 {
+		img = orient(img, orientation)
+		var buffer bytes.Buffer
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: ORIGINAL_JPEG_QUALITY}); err != nil {
+			return err
+		}
+		stripped = buffer.Bytes()
+	}
+	if err := p.store.Put(ctx, attachment.StorageKey, bytes.NewReader(stripped), int64(len(stripped)), attachment.ContentType); err != nil {
+		return err
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	attachment.Size = int64(len(stripped))
+	attachment.Width, attachment.Height = &width, &height
+
+	base := strings.TrimSuffix(attachment.StorageKey, path.Ext(attachment.StorageKey))
+	attachment.Variants = make([]*models.AttachmentVariant, 0, len(VARIANTS))
+	for _, spec := range VARIANTS {
+		resized := fit(img, spec.Size)
+		encoded, contentType, extension, err := encode(resized)
+		if err != nil {
+			return err
+		}
+		variant := &models.AttachmentVariant{
+			Name:        spec.Name,
+			StorageKey:  base + "_" + spec.Name + extension,
+			ContentType: contentType,
+			Size:        int64(len(encoded)),
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+		}
+		if err := p.store.Put(ctx, variant.StorageKey, bytes.NewReader(encoded), variant.Size, contentType); err != nil {
+			return err
+		}
+		attachment.Variants = append(attachment.Variants, variant)
+	}
+
+	if err := repository.CompleteAttachment(ctx, attachment); err != nil {
+		return err
+	}
+	// only wasted space if it stays behind
+	if err := p.store.Delete(ctx, UploadKey(attachment.StorageKey)); err != nil {
+		log.Println("media:", attachment.Id, err)
+	}
+	return nil
+}
+
+func (p *Pipeline) read(ctx context.Context, key string) ([]byte, error) {
+	body, err := p.store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(io.LimitReader(body, models.MAX_ATTACHMENT_SIZE+1))
+}
@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/adrisongomez/project-go/models"
 	"github.com/adrisongomez/project-go/repository"
 	"github.com/adrisongomez/project-go/server"
 	"github.com/adrisongomez/project-go/utils"
@@ -15,6 +16,12 @@ var (
 		"login",
 		"signup",
 	}
+	// the routes that accept the token as the access_token query parameter
+	STREAM_ROUTES = []string{
+		"/ws",
+		"/api/v1/ws",
+		"/api/v1/events",
+	}
 )
 
 func shouldCheckToken(route string) bool {
@@ -27,6 +34,43 @@ func shouldCheckToken(route string) bool {
 	return true
 }
 
+func tokenFromRequest(r *http.Request) string {
+	tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
+	if tokenString == "" && isStreamRoute(r.URL.Path) {
+		// browsers cannot set headers on websocket or EventSource requests;
+		// anywhere else a token in the URL would only end up in logs
+		tokenString = r.URL.Query().Get("access_token")
+	}
+	return tokenString
+}
+
+func isStreamRoute(route string) bool {
+	for _, p := range STREAM_ROUTES {
+		if route == p {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate validates the token and returns a context carrying the claims
+// and the user. The returned status tells how to report a failure.
+func authenticate(s server.Server, r *http.Request, tokenString string) (context.Context, int, error) {
+	claims, err := utils.ValidateToken(tokenString, s.Config().JwtSecret)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+
+	user, err := repository.GetUserById(r.Context(), claims.UserId)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	ctx := context.WithValue(r.Context(), utils.CLAIMS_KEY, claims)
+	ctx = context.WithValue(ctx, utils.USER_KEY, user)
+	return ctx, http.StatusOK, nil
+}
+
 func CheckAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -34,22 +78,38 @@ func CheckAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
 				next.ServeHTTP(w, r)
 				return
 			}
+			if _, ok := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims); ok {
+				// already authenticated by OptionalAuthMiddleware
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			tokenString := strings.TrimSpace(r.Header.Get("Authorization"))
-			claims, err := utils.ValidateToken(tokenString, s.Config().JwtSecret)
+			ctx, status, err := authenticate(s, r, tokenFromRequest(r))
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusUnauthorized)
+				http.Error(w, err.Error(), status)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// OptionalAuthMiddleware identifies the caller on public routes when a token
+// is sent. Requests without a token go through anonymously.
+func OptionalAuthMiddleware(s server.Server) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenString := tokenFromRequest(r)
+			if tokenString == "" || !shouldCheckToken(r.URL.Path) {
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			user, err := repository.GetUserById(r.Context(), claims.UserId)
+			ctx, status, err := authenticate(s, r, tokenString)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				http.Error(w, err.Error(), status)
 				return
 			}
-
-			ctx := context.WithValue(r.Context(), utils.CLAIMS_KEY, claims)
-			ctx = context.WithValue(ctx, utils.USER_KEY, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/server"
+	"github.com/adrisongomez/project-go/utils"
+)
+
+// RequireModeratorMiddleware lets through the users listed as moderators in
+// the configuration. It runs after CheckAuthMiddleware.
+func RequireModeratorMiddleware(s server.Server) func(h http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(utils.CLAIMS_KEY).(*models.AppClaims)
+			if !ok || !s.Config().IsModerator(claims.UserId) {
+				http.Error(w, "moderators only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
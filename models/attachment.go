@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+const (
+	MAX_ATTACHMENT_SIZE      = 10 << 20
+	MAX_ATTACHMENTS_PER_POST = 10
+
+	// images stay processing until their variants are generated
+	ATTACHMENT_STATUS_PROCESSING = "processing"
+	ATTACHMENT_STATUS_READY      = "ready"
+	ATTACHMENT_STATUS_FAILED     = "failed"
+)
+
+// ATTACHMENT_TYPES maps the content types accepted for uploads, as sniffed
+// from the file itself, to the extension they are stored with.
+var ATTACHMENT_TYPES = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+type Attachment struct {
+	Id          string    `json:"id"`
+	PostId      string    `json:"post_id"`
+	UserId      string    `json:"user_id"`
+	StorageKey  string    `json:"-"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       *int      `json:"width,omitempty"`
+	Height      *int      `json:"height,omitempty"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at"`
+	// resized copies of images, once processed
+	Variants []*AttachmentVariant `json:"variants,omitempty"`
+	// signed download link, valid for a limited time; only once ready
+	URL string `json:"url,omitempty"`
+}
+
+type AttachmentVariant struct {
+	Name        string `json:"name"`
+	StorageKey  string `json:"-"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	URL         string `json:"url,omitempty"`
+}
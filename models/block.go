@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Block struct {
+	UserId    string    `json:"user_id"`
+	BlockedAt time.Time `json:"blocked_at"`
+}
+
+type Mute struct {
+	UserId  string    `json:"user_id"`
+	MutedAt time.Time `json:"muted_at"`
+}
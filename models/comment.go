@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type Comment struct {
+	Id        string     `json:"id"`
+	PostId    string     `json:"post_id"`
+	UserId    string     `json:"user_id"`
+	ParentId  *string    `json:"parent_id"`
+	Depth     int        `json:"depth"`
+	Content   string     `json:"content"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Replies   []*Comment `json:"replies,omitempty"`
+}
@@ -0,0 +1,39 @@
+package models
+
+import "time"
+
+type Conversation struct {
+	Id           string    `json:"id"`
+	FirstUserId  string    `json:"first_user_id"`
+	SecondUserId string    `json:"second_user_id"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (c *Conversation) HasMember(userId string) bool {
+	return c.FirstUserId == userId || c.SecondUserId == userId
+}
+
+// OtherMember returns the participant that is not userId.
+func (c *Conversation) OtherMember(userId string) string {
+	if c.FirstUserId == userId {
+		return c.SecondUserId
+	}
+	return c.FirstUserId
+}
+
+type Message struct {
+	Id             string     `json:"id"`
+	ConversationId string     `json:"conversation_id"`
+	SenderId       string     `json:"sender_id"`
+	RecipientId    string     `json:"recipient_id"`
+	Content        string     `json:"content"`
+	CreatedAt      time.Time  `json:"created_at"`
+	DeliveredAt    *time.Time `json:"delivered_at"`
+	ReadAt         *time.Time `json:"read_at"`
+}
+
+type MessageReceiptPayload struct {
+	ConversationId string    `json:"conversation_id"`
+	UserId         string    `json:"user_id"`
+	At             time.Time `json:"at"`
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PostCursor points at a post in a listing ordered by creation time, with
+// the id breaking ties. Backward cursors page towards newer posts. The
+// message history pages the same way.
+type PostCursor struct {
+	CreatedAt time.Time
+	Id        string
+	Backward  bool
+}
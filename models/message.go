@@ -1,6 +1,67 @@
 package models
 
+import "encoding/json"
+
+const (
+	// sent instead of a replay when the requested events are no longer
+	// retained, or as soon as events were lost between instances; the client
+	// should refetch state over HTTP
+	STREAM_GAP        = "stream.gap"
+	PRESENCE_ONLINE   = "presence.online"
+	PRESENCE_OFFLINE  = "presence.offline"
+	MESSAGE_CREATED   = "message.created"
+	MESSAGE_DELIVERED = "message.delivered"
+	MESSAGE_READ      = "message.read"
+	COMMENT_CREATED   = "comment.created"
+	MENTION_CREATED   = "mention.created"
+	ATTACHMENT_READY  = "attachment.ready"
+	ATTACHMENT_FAILED = "attachment.failed"
+	// the link previews of a post, once fetched
+	POST_PREVIEWS = "post.previews"
+	// a post was hidden by moderation; clients should drop it
+	POST_HIDDEN = "post.hidden"
+	// ephemeral, never stored nor replayed
+	SIGNAL = "signal"
+)
+
+// topics are named "<kind>:<id>" after what they are about
+const (
+	TOPIC_CONVERSATION = "conversation"
+	TOPIC_POST         = "post"
+)
+
 type WebsocketMessage struct {
+	Id      uint64      `json:"id,omitempty"`
 	Type    string      `json:"type"`
 	Payload interface{} `json:"payload"`
 }
+
+type StreamGapPayload struct {
+	LastEventId uint64 `json:"last_event_id"`
+	NextEventId uint64 `json:"next_event_id"`
+}
+
+type PresencePayload struct {
+	UserId string `json:"user_id"`
+}
+
+// SignalPayload carries ephemeral state such as typing or focus. Active
+// signals expire after ExpiresIn seconds unless refreshed, and are cleared
+// by the server when the sender disconnects.
+type SignalPayload struct {
+	Topic     string          `json:"topic"`
+	Kind      string          `json:"kind"`
+	Active    bool            `json:"active"`
+	UserId    string          `json:"user_id"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ExpiresIn int             `json:"expires_in,omitempty"`
+}
+
+type PostHiddenPayload struct {
+	PostId string `json:"post_id"`
+}
+
+type MentionPayload struct {
+	PostId   string `json:"post_id"`
+	AuthorId string `json:"author_id"`
+}
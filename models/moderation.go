@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+const (
+	REPORT_OPEN      = "open"
+	REPORT_RESOLVED  = "resolved"
+	REPORT_DISMISSED = "dismissed"
+
+	// posts are hidden once this many users have reported them, unless
+	// configured otherwise
+	AUTO_HIDE_REPORTS = 5
+	MAX_REPORT_REASON = 1000
+
+	// moderation actions, as written in the audit log
+	MODERATION_REPORTED  = "post.reported"
+	MODERATION_FLAGGED   = "post.flagged"
+	MODERATION_REJECTED  = "post.rejected"
+	MODERATION_HIDDEN    = "post.hidden"
+	MODERATION_RESOLVED  = "report.resolved"
+	MODERATION_DISMISSED = "report.dismissed"
+)
+
+// Report asks the moderators to review a post. Reports filed by the filters
+// have no reporter.
+type Report struct {
+	Id         string     `json:"id"`
+	PostId     string     `json:"post_id"`
+	ReporterId string     `json:"reporter_id,omitempty"`
+	Reason     string     `json:"reason"`
+	Status     string     `json:"status"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+}
+
+// ModerationLogEntry records a moderation action. Automated actions have no
+// actor.
+type ModerationLogEntry struct {
+	Id        uint64    `json:"id"`
+	ActorId   string    `json:"actor_id,omitempty"`
+	Action    string    `json:"action"`
+	UserId    string    `json:"user_id,omitempty"`
+	PostId    string    `json:"post_id,omitempty"`
+	ReportId  string    `json:"report_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -2,9 +2,52 @@ package models
 
 import "time"
 
+const (
+	// drafts and scheduled posts are only visible to their author
+	POST_DRAFT     = "draft"
+	POST_SCHEDULED = "scheduled"
+	POST_PUBLISHED = "published"
+
+	// unlisted posts are left out of the listings, search and tags but are
+	// otherwise public
+	VISIBILITY_PUBLIC    = "public"
+	VISIBILITY_UNLISTED  = "unlisted"
+	VISIBILITY_FOLLOWERS = "followers"
+	VISIBILITY_PRIVATE   = "private"
+
+	POST_FORMAT_PLAIN    = "plain"
+	POST_FORMAT_MARKDOWN = "markdown"
+
+	// how long deleted posts stay in the trash before they are purged
+	POST_TRASH_RETENTION = 30 * 24 * time.Hour
+)
+
+var VISIBILITIES = map[string]bool{
+	VISIBILITY_PUBLIC:    true,
+	VISIBILITY_UNLISTED:  true,
+	VISIBILITY_FOLLOWERS: true,
+	VISIBILITY_PRIVATE:   true,
+}
+
 type Post struct {
-	Id          string    `json:"id"`
-	PostContent string    `json:"post_content"`
-	CreatedAt   time.Time `json:"created_at"`
-	UserId      string    `json:"user_id"`
+	Id          string `json:"id"`
+	PostContent string `json:"post_content"`
+	Format      string `json:"format"`
+	// rendered from PostContent when it is saved, safe to embed
+	PostHTML   string     `json:"post_html"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	Edited     bool       `json:"edited"`
+	UserId     string     `json:"user_id"`
+	Status     string     `json:"status"`
+	PublishAt  *time.Time `json:"publish_at,omitempty"`
+	Visibility string     `json:"visibility"`
+	DeletedAt  *time.Time `json:"deleted_at,omitempty"`
+	// hidden by moderation; only the author still sees the post
+	HiddenAt     *time.Time        `json:"hidden_at,omitempty"`
+	CommentCount uint64            `json:"comment_count"`
+	Reactions    map[string]uint64 `json:"reactions"`
+	MyReactions  []string          `json:"my_reactions,omitempty"`
+	Attachments  []*Attachment     `json:"attachments,omitempty"`
+	Previews     []*LinkPreview    `json:"previews,omitempty"`
 }
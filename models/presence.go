@@ -0,0 +1,6 @@
+package models
+
+type OnlineUser struct {
+	UserId      string `json:"user_id"`
+	Connections int    `json:"connections"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	// only the first links of a post are unfurled
+	MAX_PREVIEWS_PER_POST = 3
+	// cached previews are fetched again once they are this old
+	LINK_PREVIEW_TTL = 24 * time.Hour
+)
+
+// LinkPreview is the OpenGraph or Twitter card metadata of a page linked
+// from a post.
+type LinkPreview struct {
+	URL         string    `json:"url"`
+	Title       string    `json:"title"`
+	Description string    `json:"description,omitempty"`
+	ImageURL    string    `json:"image_url,omitempty"`
+	SiteName    string    `json:"site_name,omitempty"`
+	FetchedAt   time.Time `json:"fetched_at"`
+}
+
+type LinkPreviewsPayload struct {
+	PostId   string         `json:"post_id"`
+	Previews []*LinkPreview `json:"previews"`
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	MAX_CONTAINS_LENGTH = 100
+)
+
+// POST_FIELDS are the fields of a post that can be picked with a sparse
+// fieldset.
+var POST_FIELDS = map[string]bool{
+	"id":            true,
+	"post_content":  true,
+	"format":        true,
+	"post_html":     true,
+	"created_at":    true,
+	"updated_at":    true,
+	"edited":        true,
+	"user_id":       true,
+	"status":        true,
+	"publish_at":    true,
+	"visibility":    true,
+	"comment_count": true,
+	"reactions":     true,
+	"my_reactions":  true,
+	"attachments":   true,
+	"previews":      true,
+}
+
+// PostQuery describes a page of the post listing. Results are ordered by
+// creation time, newest first unless Ascending is set.
+type PostQuery struct {
+	// the caller, empty when anonymous; only the posts visible to them are
+	// listed
+	ViewerId string
+	UserId   string
+	// published unless set; other statuses only make sense along with the
+	// UserId of their author
+	Status        string
+	Tag           string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	Contains      string
+	Ascending     bool
+	Cursor        *PostCursor
+	Limit         uint64
+	Fields        []string
+}
+
+func (q *PostQuery) Validate() error {
+	if q.Limit == 0 {
+		return errors.New("limit must be positive")
+	}
+	if q.CreatedAfter != nil && q.CreatedBefore != nil && !q.CreatedAfter.Before(*q.CreatedBefore) {
+		return errors.New("created_after must be before created_before")
+	}
+	switch q.Status {
+	case "", POST_PUBLISHED, POST_DRAFT, POST_SCHEDULED:
+	default:
+		return errors.New("status must be draft, scheduled or published")
+	}
+	if len(q.Contains) > MAX_CONTAINS_LENGTH {
+		return errors.New("contains is too long")
+	}
+	for _, field := range q.Fields {
+		if !POST_FIELDS[field] {
+			return errors.New("unknown field " + field)
+		}
+	}
+	return nil
+}
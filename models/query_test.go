@@ -0,0 +1,49 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPostQueryValidate(t *testing.T) {
+	day := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	next := day.Add(24 * time.Hour)
+	for name, test := range map[string]struct {
+		query PostQuery
+		valid bool
+	}{
+		"defaults":          {PostQuery{Limit: 1}, true},
+		"no limit":          {PostQuery{}, false},
+		"time range":        {PostQuery{Limit: 1, CreatedAfter: &day, CreatedBefore: &next}, true},
+		"empty time range":  {PostQuery{Limit: 1, CreatedAfter: &day, CreatedBefore: &day}, false},
+		"reversed range":    {PostQuery{Limit: 1, CreatedAfter: &next, CreatedBefore: &day}, false},
+		"open range":        {PostQuery{Limit: 1, CreatedAfter: &next}, true},
+		"draft":             {PostQuery{Limit: 1, Status: POST_DRAFT}, true},
+		"scheduled":         {PostQuery{Limit: 1, Status: POST_SCHEDULED}, true},
+		"unknown status":    {PostQuery{Limit: 1, Status: "archived"}, false},
+		"longest contains":  {PostQuery{Limit: 1, Contains: strings.Repeat("a", MAX_CONTAINS_LENGTH)}, true},
+		"too long contains": {PostQuery{Limit: 1, Contains: strings.Repeat("a", MAX_CONTAINS_LENGTH+1)}, false},
+		"fields":            {PostQuery{Limit: 1, Fields: []string{"id", "previews"}}, true},
+		"unknown field":     {PostQuery{Limit: 1, Fields: []string{"id", "deleted_at"}}, false},
+	} {
+		if err := test.query.Validate(); (err == nil) != test.valid {
+			t.Errorf("%s: got %v, want valid %v", name, err, test.valid)
+		}
+	}
+}
+
+func TestPostFieldsAreJSONFields(t *testing.T) {
+	tags := make(map[string]bool)
+	post := reflect.TypeOf(Post{})
+	for i := 0; i < post.NumField(); i++ {
+		name, _, _ := strings.Cut(post.Field(i).Tag.Get("json"), ",")
+		tags[name] = true
+	}
+	for field := range POST_FIELDS {
+		if !tags[field] {
+			t.Errorf("%s is not a field of a post", field)
+		}
+	}
+}
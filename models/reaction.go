@@ -0,0 +1,17 @@
+package models
+
+// REACTION_KINDS is the fixed set of reactions users can leave on a post.
+var REACTION_KINDS = map[string]string{
+	"like":  "👍",
+	"love":  "❤️",
+	"laugh": "😂",
+	"wow":   "😮",
+	"sad":   "😢",
+	"angry": "😡",
+}
+
+type Reaction struct {
+	PostId string `json:"post_id"`
+	UserId string `json:"user_id"`
+	Kind   string `json:"kind"`
+}
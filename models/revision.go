@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+const (
+	DIFF_EQUAL  = "equal"
+	DIFF_INSERT = "insert"
+	DIFF_DELETE = "delete"
+)
+
+// PostRevision is an immutable copy of a post as it was after an edit. The
+// content the post was created with is revision 1.
+type PostRevision struct {
+	PostId      string    `json:"post_id"`
+	Revision    int       `json:"revision"`
+	PostContent string    `json:"post_content"`
+	Format      string    `json:"format"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type DiffChunk struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// RevisionDiff describes how to go from the content of revision From to the
+// content of revision To.
+type RevisionDiff struct {
+	PostId string      `json:"post_id"`
+	From   int         `json:"from"`
+	To     int         `json:"to"`
+	Chunks []DiffChunk `json:"chunks"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "encoding/json"
+
+const (
+	RPC_ACK   = "ack"
+	RPC_ERROR = "error"
+)
+
+// RpcRequest is a frame sent by a client over the websocket. Id is chosen
+// by the client and echoed back on the reply.
+type RpcRequest struct {
+	Id      json.RawMessage `json:"id"`
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+type RpcResponse struct {
+	Id      json.RawMessage `json:"id"`
+	Type    string          `json:"type"`
+	Payload interface{}     `json:"payload"`
+}
+
+type RpcError struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (e *RpcError) Error() string {
+	return e.Message
+}
@@ -0,0 +1,39 @@
+package models
+
+import "errors"
+
+const (
+	MAX_SEARCH_OFFSET = 1000
+)
+
+type SearchQuery struct {
+	// the caller, empty when anonymous
+	ViewerId string
+	Text     string
+	Limit    uint64
+	Offset   uint64
+}
+
+func (q *SearchQuery) Validate() error {
+	if q.Text == "" {
+		return errors.New("q is required")
+	}
+	if len(q.Text) > MAX_CONTAINS_LENGTH {
+		return errors.New("q is too long")
+	}
+	if q.Limit == 0 {
+		return errors.New("limit must be positive")
+	}
+	if q.Offset > MAX_SEARCH_OFFSET {
+		return errors.New("offset is too large")
+	}
+	return nil
+}
+
+// SearchResult is a post matching a search. Snippet is HTML-escaped with the
+// matching terms wrapped in <mark>.
+type SearchResult struct {
+	Post    *Post   `json:"post"`
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
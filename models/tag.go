@@ -0,0 +1,6 @@
+package models
+
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count uint64 `json:"count"`
+}
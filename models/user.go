@@ -4,4 +4,5 @@ type User struct {
 	Id       string  `json:"id"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Handle   string `json:"handle,omitempty"`
 }
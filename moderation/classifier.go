@@ -0,0 +1,74 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+const (
+	ACTION_ALLOW = ""
+	// the content is published and queued for review
+	ACTION_FLAG = "flag"
+	// the content is refused
+	ACTION_REJECT = "reject"
+)
+
+var ErrRejected = errors.New("content rejected by moderation")
+
+// Verdict is what a classifier decides about a piece of content.
+type Verdict struct {
+	Action string
+	Reason string
+}
+
+func (v *Verdict) Err() error {
+	if v.Action != ACTION_REJECT {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrRejected, v.Reason)
+}
+
+// Classifier reviews content before it is saved. Implementations backed by
+// an external service should honour the deadline of ctx.
+type Classifier interface {
+	Classify(ctx context.Context, content string) (*Verdict, error)
+}
+
+var severity = map[string]int{
+	ACTION_ALLOW:  0,
+	ACTION_FLAG:   1,
+	ACTION_REJECT: 2,
+}
+
+// Moderator runs content through every classifier and keeps the most severe
+// verdict.
+type Moderator struct {
+	classifiers []Classifier
+}
+
+func NewModerator(classifiers ...Classifier) *Moderator {
+	return &Moderator{classifiers: classifiers}
+}
+
+// Use adds a classifier. It must be called before the server starts.
+func (m *Moderator) Use(classifier Classifier) {
+	m.classifiers = append(m.classifiers, classifier)
+}
+
+func (m *Moderator) Check(ctx context.Context, content string) (*Verdict, error) {
+	verdict := &Verdict{Action: ACTION_ALLOW}
+	for _, classifier := range m.classifiers {
+		found, err := classifier.Classify(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		if found != nil && severity[found.Action] > severity[verdict.Action] {
+			verdict = found
+		}
+		if verdict.Action == ACTION_REJECT {
+			break
+		}
+	}
+	return verdict, nil
+}
@@ -0,0 +1,77 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// fixedClassifier returns the same verdict, or error, for any content and
+// counts its calls.
+type fixedClassifier struct {
+	verdict *Verdict
+	err     error
+	calls   int
+}
+
+func (c *fixedClassifier) Classify(ctx context.Context, content string) (*Verdict, error) {
+	c.calls++
+	return c.verdict, c.err
+}
+
+func returning(action string, reason string) *fixedClassifier {
+	return &fixedClassifier{verdict: &Verdict{Action: action, Reason: reason}}
+}
+
+func TestModeratorCheck(t *testing.T) {
+	for name, test := range map[string]struct {
+		classifiers []*fixedClassifier
+		action      string
+		reason      string
+	}{
+		"no classifiers":        {nil, ACTION_ALLOW, ""},
+		"allowed":               {[]*fixedClassifier{returning(ACTION_ALLOW, "")}, ACTION_ALLOW, ""},
+		"no verdict":            {[]*fixedClassifier{{}}, ACTION_ALLOW, ""},
+		"flag then reject":      {[]*fixedClassifier{returning(ACTION_FLAG, "casino"), returning(ACTION_REJECT, "spam")}, ACTION_REJECT, "spam"},
+		"reject then flag":      {[]*fixedClassifier{returning(ACTION_REJECT, "spam"), returning(ACTION_FLAG, "casino")}, ACTION_REJECT, "spam"},
+		"first flag is kept":    {[]*fixedClassifier{returning(ACTION_FLAG, "casino"), returning(ACTION_FLAG, "lottery")}, ACTION_FLAG, "casino"},
+		"allow after flag":      {[]*fixedClassifier{returning(ACTION_FLAG, "casino"), returning(ACTION_ALLOW, "")}, ACTION_FLAG, "casino"},
+		"flag after no verdict": {[]*fixedClassifier{{}, returning(ACTION_FLAG, "casino")}, ACTION_FLAG, "casino"},
+	} {
+		moderator := NewModerator()
+		for _, classifier := range test.classifiers {
+			moderator.Use(classifier)
+		}
+		verdict, err := moderator.Check(context.Background(), "content")
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if verdict.Action != test.action || verdict.Reason != test.reason {
+			t.Errorf("%s: got %+v, want %q because %q", name, verdict, test.action, test.reason)
+		}
+	}
+}
+
+func TestModeratorCheckStopsAtReject(t *testing.T) {
+	after := returning(ACTION_FLAG, "casino")
+	moderator := NewModerator(returning(ACTION_REJECT, "spam"), after)
+	verdict, err := moderator.Check(context.Background(), "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(verdict.Err(), ErrRejected) {
+		t.Errorf("got %v, want %v", verdict.Err(), ErrRejected)
+	}
+	if after.calls != 0 {
+		t.Error("content was classified after it was rejected")
+	}
+}
+
+func TestModeratorCheckFails(t *testing.T) {
+	down := errors.New("classifier is down")
+	moderator := NewModerator(returning(ACTION_FLAG, "casino"), &fixedClassifier{err: down})
+	if verdict, err := moderator.Check(context.Background(), "content"); !errors.Is(err, down) {
+		t.Errorf("got %+v, %v, want %v", verdict, err, down)
+	}
+}
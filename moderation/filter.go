@@ -0,0 +1,86 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+type rule struct {
+	source  string
+	pattern *regexp.Regexp
+	action  string
+}
+
+// Filter is a Classifier matching words and regular expressions. Each line
+// of its configuration is a rule: a word, matched whole and ignoring case,
+// or a /regular expression/. Rules reject by default, or flag when prefixed
+// with "flag:". Blank lines and lines starting with # are skipped.
+type Filter struct {
+	rules []rule
+}
+
+// LoadFilter reads the rules from the file at path.
+func LoadFilter(path string) (*Filter, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ParseFilter(file)
+}
+
+func ParseFilter(r io.Reader) (*Filter, error) {
+	filter := &Filter{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		action := ACTION_REJECT
+		if strings.HasPrefix(text, "flag:") {
+			action = ACTION_FLAG
+			text = strings.TrimSpace(strings.TrimPrefix(text, "flag:"))
+		}
+
+		var expression string
+		if len(text) > 2 && strings.HasPrefix(text, "/") && strings.HasSuffix(text, "/") {
+			expression = "(?i)" + text[1:len(text)-1]
+		} else {
+			expression = `(?i)(?:^|[^\p{L}\p{N}_])` + regexp.QuoteMeta(text) + `(?:$|[^\p{L}\p{N}_])`
+		}
+		pattern, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("filter line %d: %w", line, err)
+		}
+		filter.rules = append(filter.rules, rule{source: text, pattern: pattern, action: action})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// Classify returns the verdict of the first rejecting rule that matches, or
+// else of the first flagging one.
+func (f *Filter) Classify(ctx context.Context, content string) (*Verdict, error) {
+	var flagged *Verdict
+	for _, rule := range f.rules {
+		if !rule.pattern.MatchString(content) {
+			continue
+		}
+		verdict := &Verdict{Action: rule.action, Reason: fmt.Sprintf("matches the filter %q", rule.source)}
+		if rule.action == ACTION_REJECT {
+			return verdict, nil
+		}
+		if flagged == nil {
+			flagged = verdict
+		}
+	}
+	return flagged, nil
+}
@@ -0,0 +1,80 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testFilter = `
+# words are matched whole
+spam
+flag: casino
+flag:  /free\s+money/
+/buy (cheap|now)/
+
+`
+
+func TestFilterClassify(t *testing.T) {
+	filter, err := ParseFilter(strings.NewReader(testFilter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for content, want := range map[string]string{
+		"a perfectly fine post":      ACTION_ALLOW,
+		"SPAM!":                      ACTION_REJECT,
+		"spam":                       ACTION_REJECT,
+		"spammer and antispam":       ACTION_ALLOW,
+		"(spam)":                     ACTION_REJECT,
+		"the casino opens":           ACTION_FLAG,
+		"casinos":                    ACTION_ALLOW,
+		"get FREE   money":           ACTION_FLAG,
+		"buy now":                    ACTION_REJECT,
+		"free money, buy cheap":      ACTION_REJECT,
+		"the casino is full of spam": ACTION_REJECT,
+	} {
+		verdict, err := filter.Classify(context.Background(), content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ACTION_ALLOW
+		if verdict != nil {
+			got = verdict.Action
+		}
+		if got != want {
+			t.Errorf("Classify(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestFilterReason(t *testing.T) {
+	filter, err := ParseFilter(strings.NewReader(testFilter))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verdict, _ := filter.Classify(context.Background(), "casino spam")
+	if verdict.Reason != `matches the filter "spam"` {
+		t.Errorf("reason %q, want the rejecting rule", verdict.Reason)
+	}
+	if err := verdict.Err(); !errors.Is(err, ErrRejected) {
+		t.Errorf("got %v, want ErrRejected", err)
+	}
+
+	verdict, _ = filter.Classify(context.Background(), "free money at the casino")
+	if verdict.Reason != `matches the filter "casino"` {
+		t.Errorf("reason %q, want the first flagging rule", verdict.Reason)
+	}
+	if err := verdict.Err(); err != nil {
+		t.Errorf("a flag is an error: %v", err)
+	}
+}
+
+func TestParseFilterRejectsInvalidExpression(t *testing.T) {
+	_, err := ParseFilter(strings.NewReader("spam\n\n/broken(/\n"))
+	if err == nil || !strings.Contains(err.Error(), "line 3") {
+		t.Errorf("got %v, want an error on line 3", err)
+	}
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/adrisongomez/project-go/models"
 )
@@ -12,18 +14,113 @@ type Repository interface {
 	InsertUser(ctx context.Context, user *models.User) error
 	GetUserById(ctx context.Context, id string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUsersByHandles(ctx context.Context, handles []string) ([]*models.User, error)
 
 	// post methods
 	GetPostById(ctx context.Context, id string) (*models.Post, error)
 	InsertPost(ctx context.Context, post *models.Post) error
 	UpdatePost(ctx context.Context, post *models.Post) error
+	SetPostStatus(ctx context.Context, post *models.Post) error
+	GetVisiblePost(ctx context.Context, id string, viewerId string) (*models.Post, error)
+	SetPostVisibility(ctx context.Context, post *models.Post) error
+	PublishDuePosts(ctx context.Context, limit int) ([]*models.Post, error)
 	DeletePost(ctx context.Context, id string, userId string) error
-	ListPost(ctx context.Context, page uint64) ([]*models.Post, error)
+	ListTrash(ctx context.Context, userId string, cursor *models.PostCursor, limit uint64) ([]*models.Post, error)
+	RestorePost(ctx context.Context, post *models.Post) error
+	PurgeDeletedPosts(ctx context.Context, olderThan time.Duration, limit int) (int, []string, error)
+	ListPost(ctx context.Context, query *models.PostQuery) ([]*models.Post, error)
+	// Deprecated: offset pagination, kept while clients move to cursors
+	ListPostPage(ctx context.Context, page uint64, viewerId string) ([]*models.Post, error)
+
+	// tags and mentions
+	ReplacePostTags(ctx context.Context, postId string, tags []string) error
+	ReplacePostMentions(ctx context.Context, postId string, userIds []string) ([]string, error)
+	TrendingTags(ctx context.Context, since time.Time, limit uint64) ([]*models.TagCount, error)
+
+	// link previews
+	GetLinkPreviews(ctx context.Context, urls []string) (map[string]*models.LinkPreview, error)
+	SaveLinkPreview(ctx context.Context, preview *models.LinkPreview) error
+	ReplacePostPreviews(ctx context.Context, postId string, urls []string) (bool, error)
+	ListPostPreviews(ctx context.Context, postIds []string) (map[string][]*models.LinkPreview, error)
+
+	// attachments
+	InsertAttachment(ctx context.Context, attachment *models.Attachment) error
+	GetAttachmentById(ctx context.Context, id string) (*models.Attachment, error)
+	ListAttachments(ctx context.Context, postIds []string) (map[string][]*models.Attachment, error)
+	DeleteAttachment(ctx context.Context, id string) error
+	ListProcessingAttachments(ctx context.Context) ([]*models.Attachment, error)
+	CompleteAttachment(ctx context.Context, attachment *models.Attachment) error
+	SetAttachmentStatus(ctx context.Context, id string, status string) error
+	ListPostRevisions(ctx context.Context, postId string) ([]*models.PostRevision, error)
+	GetPostRevision(ctx context.Context, postId string, revision int) (*models.PostRevision, error)
+
+	// moderation
+	InsertReport(ctx context.Context, report *models.Report, hideAfter int) (bool, error)
+	ListReports(ctx context.Context, status string, page uint64) ([]*models.Report, error)
+	CloseReport(ctx context.Context, report *models.Report) error
+	InsertModerationLog(ctx context.Context, entry *models.ModerationLogEntry) error
+	ListModerationLog(ctx context.Context, page uint64) ([]*models.ModerationLogEntry, error)
+
+	// comments
+	InsertComment(ctx context.Context, comment *models.Comment) error
+	GetCommentById(ctx context.Context, id string) (*models.Comment, error)
+	UpdateComment(ctx context.Context, comment *models.Comment) error
+	DeleteComment(ctx context.Context, id string) error
+	ListComments(ctx context.Context, postId string, viewerId string) ([]*models.Comment, error)
+	GetCommentCounts(ctx context.Context, postIds []string, viewerId string) (map[string]uint64, error)
+
+	// reactions
+	AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error)
+	RemoveReaction(ctx context.Context, reaction *models.Reaction) (bool, error)
+	GetReactionCounts(ctx context.Context, postIds []string) (map[string]map[string]uint64, error)
+	GetUserReactions(ctx context.Context, postIds []string, userId string) (map[string][]string, error)
+
+	// follows
+	Follow(ctx context.Context, followerId string, followedId string) error
+	Unfollow(ctx context.Context, followerId string, followedId string) error
+	ListFollowers(ctx context.Context, userId string) ([]*models.Follow, error)
+	ListFollowing(ctx context.Context, userId string) ([]*models.Follow, error)
+	GetTimeline(ctx context.Context, userId string, cursor *models.PostCursor, limit uint64) ([]*models.Post, error)
+
+	// blocks and mutes
+	Block(ctx context.Context, blockerId string, blockedId string) error
+	Unblock(ctx context.Context, blockerId string, blockedId string) error
+	ListBlocks(ctx context.Context, userId string) ([]*models.Block, error)
+	Mute(ctx context.Context, muterId string, mutedId string) error
+	Unmute(ctx context.Context, muterId string, mutedId string) error
+	ListMutes(ctx context.Context, userId string) ([]*models.Mute, error)
+	AreBlocked(ctx context.Context, userId string, otherId string) (bool, error)
+	IsMuted(ctx context.Context, muterId string, mutedId string) (bool, error)
+	ListExcludedUsers(ctx context.Context, userId string) ([]string, error)
+	ListHiddenUsers(ctx context.Context, viewerId string) ([]string, error)
+
+	// direct messages
+	InsertConversation(ctx context.Context, conversation *models.Conversation) error
+	GetConversationById(ctx context.Context, id string) (*models.Conversation, error)
+	GetConversationByMembers(ctx context.Context, firstUserId string, secondUserId string) (*models.Conversation, error)
+	ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error)
+	InsertMessage(ctx context.Context, message *models.Message) error
+	ListMessages(ctx context.Context, conversationId string, cursor *models.PostCursor, limit uint64) ([]*models.Message, error)
+	MarkMessagesDelivered(ctx context.Context, conversationId string, recipientId string, at time.Time) (int64, error)
+	MarkMessagesRead(ctx context.Context, conversationId string, recipientId string, at time.Time) (int64, error)
 
 	// db general
 	Close() error
 }
 
+var (
+	ErrNotFound           = errors.New("record not found")
+	ErrTooManyAttachments = errors.New("too many attachments on this post")
+	ErrAlreadyPublished   = errors.New("post is already published")
+	ErrAlreadyReported    = errors.New("post is already reported")
+)
+
+// PostSearcher is implemented by repositories with a full-text index.
+// SearchPosts falls back to a substring match for the others.
+type PostSearcher interface {
+	SearchPosts(ctx context.Context, query *models.SearchQuery) ([]*models.SearchResult, error)
+}
+
 var implementation Repository
 
 func SetRepository(repository Repository) {
@@ -42,6 +139,10 @@ func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	return implementation.GetUserByEmail(ctx, email)
 }
 
+func GetUsersByHandles(ctx context.Context, handles []string) ([]*models.User, error) {
+	return implementation.GetUsersByHandles(ctx, handles)
+}
+
 func Close() error {
 	return implementation.Close()
 }
@@ -58,10 +159,265 @@ func UpdatePost(ctx context.Context, post *models.Post) error {
 	return implementation.UpdatePost(ctx, post)
 }
 
+func SetPostStatus(ctx context.Context, post *models.Post) error {
+	return implementation.SetPostStatus(ctx, post)
+}
+
+func GetVisiblePost(ctx context.Context, id string, viewerId string) (*models.Post, error) {
+	return implementation.GetVisiblePost(ctx, id, viewerId)
+}
+
+func SetPostVisibility(ctx context.Context, post *models.Post) error {
+	return implementation.SetPostVisibility(ctx, post)
+}
+
+func PublishDuePosts(ctx context.Context, limit int) ([]*models.Post, error) {
+	return implementation.PublishDuePosts(ctx, limit)
+}
+
 func DeletePost(ctx context.Context, id string, userId string) error {
 	return implementation.DeletePost(ctx, id, userId)
 }
 
-func ListPost(ctx context.Context, page uint64) ([]*models.Post, error) {
-	return implementation.ListPost(ctx, page)
+func ListTrash(ctx context.Context, userId string, cursor *models.PostCursor, limit uint64) ([]*models.Post, error) {
+	return implementation.ListTrash(ctx, userId, cursor, limit)
+}
+
+func RestorePost(ctx context.Context, post *models.Post) error {
+	return implementation.RestorePost(ctx, post)
+}
+
+func PurgeDeletedPosts(ctx context.Context, olderThan time.Duration, limit int) (int, []string, error) {
+	return implementation.PurgeDeletedPosts(ctx, olderThan, limit)
+}
+
+func ListPost(ctx context.Context, query *models.PostQuery) ([]*models.Post, error) {
+	return implementation.ListPost(ctx, query)
+}
+
+func ListPostPage(ctx context.Context, page uint64, viewerId string) ([]*models.Post, error) {
+	return implementation.ListPostPage(ctx, page, viewerId)
+}
+
+func InsertConversation(ctx context.Context, conversation *models.Conversation) error {
+	return implementation.InsertConversation(ctx, conversation)
+}
+
+func GetConversationById(ctx context.Context, id string) (*models.Conversation, error) {
+	return implementation.GetConversationById(ctx, id)
+}
+
+func GetConversationByMembers(ctx context.Context, firstUserId string, secondUserId string) (*models.Conversation, error) {
+	return implementation.GetConversationByMembers(ctx, firstUserId, secondUserId)
+}
+
+func ListConversations(ctx context.Context, userId string) ([]*models.Conversation, error) {
+	return implementation.ListConversations(ctx, userId)
+}
+
+func InsertMessage(ctx context.Context, message *models.Message) error {
+	return implementation.InsertMessage(ctx, message)
+}
+
+func ListMessages(ctx context.Context, conversationId string, cursor *models.PostCursor, limit uint64) ([]*models.Message, error) {
+	return implementation.ListMessages(ctx, conversationId, cursor, limit)
+}
+
+func MarkMessagesDelivered(ctx context.Context, conversationId string, recipientId string, at time.Time) (int64, error) {
+	return implementation.MarkMessagesDelivered(ctx, conversationId, recipientId, at)
+}
+
+func MarkMessagesRead(ctx context.Context, conversationId string, recipientId string, at time.Time) (int64, error) {
+	return implementation.MarkMessagesRead(ctx, conversationId, recipientId, at)
+}
+
+func InsertReport(ctx context.Context, report *models.Report, hideAfter int) (bool, error) {
+	return implementation.InsertReport(ctx, report, hideAfter)
+}
+
+func ListReports(ctx context.Context, status string, page uint64) ([]*models.Report, error) {
+	return implementation.ListReports(ctx, status, page)
+}
+
+func CloseReport(ctx context.Context, report *models.Report) error {
+	return implementation.CloseReport(ctx, report)
+}
+
+func InsertModerationLog(ctx context.Context, entry *models.ModerationLogEntry) error {
+	return implementation.InsertModerationLog(ctx, entry)
+}
+
+func ListModerationLog(ctx context.Context, page uint64) ([]*models.ModerationLogEntry, error) {
+	return implementation.ListModerationLog(ctx, page)
+}
+
+func InsertComment(ctx context.Context, comment *models.Comment) error {
+	return implementation.InsertComment(ctx, comment)
+}
+
+func GetCommentById(ctx context.Context, id string) (*models.Comment, error) {
+	return implementation.GetCommentById(ctx, id)
+}
+
+func UpdateComment(ctx context.Context, comment *models.Comment) error {
+	return implementation.UpdateComment(ctx, comment)
+}
+
+func DeleteComment(ctx context.Context, id string) error {
+	return implementation.DeleteComment(ctx, id)
+}
+
+func ListComments(ctx context.Context, postId string, viewerId string) ([]*models.Comment, error) {
+	return implementation.ListComments(ctx, postId, viewerId)
+}
+
+func GetCommentCounts(ctx context.Context, postIds []string, viewerId string) (map[string]uint64, error) {
+	return implementation.GetCommentCounts(ctx, postIds, viewerId)
+}
+
+func AddReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	return implementation.AddReaction(ctx, reaction)
+}
+
+func RemoveReaction(ctx context.Context, reaction *models.Reaction) (bool, error) {
+	return implementation.RemoveReaction(ctx, reaction)
+}
+
+func GetReactionCounts(ctx context.Context, postIds []string) (map[string]map[string]uint64, error) {
+	return implementation.GetReactionCounts(ctx, postIds)
+}
+
+func GetUserReactions(ctx context.Context, postIds []string, userId string) (map[string][]string, error) {
+	return implementation.GetUserReactions(ctx, postIds, userId)
+}
+
+func Follow(ctx context.Context, followerId string, followedId string) error {
+	return implementation.Follow(ctx, followerId, followedId)
+}
+
+func Unfollow(ctx context.Context, followerId string, followedId string) error {
+	return implementation.Unfollow(ctx, followerId, followedId)
+}
+
+func ListFollowers(ctx context.Context, userId string) ([]*models.Follow, error) {
+	return implementation.ListFollowers(ctx, userId)
+}
+
+func ListFollowing(ctx context.Context, userId string) ([]*models.Follow, error) {
+	return implementation.ListFollowing(ctx, userId)
+}
+
+func GetTimeline(ctx context.Context, userId string, cursor *models.PostCursor, limit uint64) ([]*models.Post, error) {
+	return implementation.GetTimeline(ctx, userId, cursor, limit)
+}
+
+func Block(ctx context.Context, blockerId string, blockedId string) error {
+	return implementation.Block(ctx, blockerId, blockedId)
+}
+
+func Unblock(ctx context.Context, blockerId string, blockedId string) error {
+	return implementation.Unblock(ctx, blockerId, blockedId)
+}
+
+func ListBlocks(ctx context.Context, userId string) ([]*models.Block, error) {
+	return implementation.ListBlocks(ctx, userId)
+}
+
+func Mute(ctx context.Context, muterId string, mutedId string) error {
+	return implementation.Mute(ctx, muterId, mutedId)
+}
+
+func Unmute(ctx context.Context, muterId string, mutedId string) error {
+	return implementation.Unmute(ctx, muterId, mutedId)
+}
+
+func ListMutes(ctx context.Context, userId string) ([]*models.Mute, error) {
+	return implementation.ListMutes(ctx, userId)
+}
+
+func AreBlocked(ctx context.Context, userId string, otherId string) (bool, error) {
+	return implementation.AreBlocked(ctx, userId, otherId)
+}
+
+func IsMuted(ctx context.Context, muterId string, mutedId string) (bool, error) {
+	return implementation.IsMuted(ctx, muterId, mutedId)
+}
+
+func ListExcludedUsers(ctx context.Context, userId string) ([]string, error) {
+	return implementation.ListExcludedUsers(ctx, userId)
+}
+
+func ListHiddenUsers(ctx context.Context, viewerId string) ([]string, error) {
+	return implementation.ListHiddenUsers(ctx, viewerId)
+}
+
+func SearchPosts(ctx context.Context, query *models.SearchQuery) ([]*models.SearchResult, error) {
+	if searcher, ok := implementation.(PostSearcher); ok {
+		return searcher.SearchPosts(ctx, query)
+	}
+	return searchPostsByContent(ctx, query)
+}
+
+func ReplacePostTags(ctx context.Context, postId string, tags []string) error {
+	return implementation.ReplacePostTags(ctx, postId, tags)
+}
+
+func ReplacePostMentions(ctx context.Context, postId string, userIds []string) ([]string, error) {
+	return implementation.ReplacePostMentions(ctx, postId, userIds)
+}
+
+func TrendingTags(ctx context.Context, since time.Time, limit uint64) ([]*models.TagCount, error) {
+	return implementation.TrendingTags(ctx, since, limit)
+}
+
+func GetLinkPreviews(ctx context.Context, urls []string) (map[string]*models.LinkPreview, error) {
+	return implementation.GetLinkPreviews(ctx, urls)
+}
+
+func SaveLinkPreview(ctx context.Context, preview *models.LinkPreview) error {
+	return implementation.SaveLinkPreview(ctx, preview)
+}
+
+func ReplacePostPreviews(ctx context.Context, postId string, urls []string) (bool, error) {
+	return implementation.ReplacePostPreviews(ctx, postId, urls)
+}
+
+func ListPostPreviews(ctx context.Context, postIds []string) (map[string][]*models.LinkPreview, error) {
+	return implementation.ListPostPreviews(ctx, postIds)
+}
+
+func InsertAttachment(ctx context.Context, attachment *models.Attachment) error {
+	return implementation.InsertAttachment(ctx, attachment)
+}
+
+func GetAttachmentById(ctx context.Context, id string) (*models.Attachment, error) {
+	return implementation.GetAttachmentById(ctx, id)
+}
+
+func ListAttachments(ctx context.Context, postIds []string) (map[string][]*models.Attachment, error) {
+	return implementation.ListAttachments(ctx, postIds)
+}
+
+func DeleteAttachment(ctx context.Context, id string) error {
+	return implementation.DeleteAttachment(ctx, id)
+}
+
+func ListProcessingAttachments(ctx context.Context) ([]*models.Attachment, error) {
+	return implementation.ListProcessingAttachments(ctx)
+}
+
+func CompleteAttachment(ctx context.Context, attachment *models.Attachment) error {
+	return implementation.CompleteAttachment(ctx, attachment)
+}
+
+func SetAttachmentStatus(ctx context.Context, id string, status string) error {
+	return implementation.SetAttachmentStatus(ctx, id, status)
+}
+
+func ListPostRevisions(ctx context.Context, postId string) ([]*models.PostRevision, error) {
+	return implementation.ListPostRevisions(ctx, postId)
+}
+
+func GetPostRevision(ctx context.Context, postId string, revision int) (*models.PostRevision, error) {
+	return implementation.GetPostRevision(ctx, postId, revision)
 }
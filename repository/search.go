@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"html"
+	"strings"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// searchPostsByContent matches the whole query as a substring, newest first,
+// for repositories that do not implement PostSearcher. Every result has the
+// same rank.
+func searchPostsByContent(ctx context.Context, query *models.SearchQuery) ([]*models.SearchResult, error) {
+	posts, err := implementation.ListPost(ctx, &models.PostQuery{
+		ViewerId: query.ViewerId,
+		Contains: query.Text,
+		Limit:    query.Offset + query.Limit,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]*models.SearchResult, 0, len(posts))
+	for i, post := range posts {
+		if uint64(i) < query.Offset {
+			continue
+		}
+		results = append(results, &models.SearchResult{
+			Post:    post,
+			Rank:    1,
+			Snippet: highlight(post.PostContent, query.Text),
+		})
+	}
+	return results, nil
+}
+
+func highlight(content, text string) string {
+	lowerContent := strings.ToLower(content)
+	lowerText := strings.ToLower(text)
+	var snippet strings.Builder
+	for {
+		i := strings.Index(lowerContent, lowerText)
+		if i < 0 || len(lowerContent) != len(content) {
+			snippet.WriteString(html.EscapeString(content))
+			return snippet.String()
+		}
+		snippet.WriteString(html.EscapeString(content[:i]))
+		snippet.WriteString("<mark>")
+		snippet.WriteString(html.EscapeString(content[i : i+len(text)]))
+		snippet.WriteString("</mark>")
+		content = content[i+len(text):]
+		lowerContent = lowerContent[i+len(text):]
+	}
+}
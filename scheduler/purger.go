@@ -0,0 +1,55 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/storage"
+)
+
+const (
+	PURGE_INTERVAL = time.Hour
+	PURGE_BATCH    = 100
+)
+
+// Purger permanently removes the posts whose time in the trash is over,
+// and the files attached to them.
+type Purger struct {
+	store storage.BlobStore
+}
+
+func NewPurger(store storage.BlobStore) *Purger {
+	return &Purger{store: store}
+}
+
+func (p *Purger) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.purge()
+		<-ticker.C
+	}
+}
+
+func (p *Purger) purge() {
+	ctx := context.Background()
+	for {
+		purged, keys, err := repository.PurgeDeletedPosts(ctx, models.POST_TRASH_RETENTION, PURGE_BATCH)
+		if err != nil {
+			log.Println("purger:", err)
+			return
+		}
+		for _, key := range keys {
+			// a blob left behind is only wasted space
+			if err := p.store.Delete(ctx, key); err != nil {
+				log.Println("purger:", key, err)
+			}
+		}
+		if purged < PURGE_BATCH {
+			return
+		}
+	}
+}
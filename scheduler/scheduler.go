@@ -0,0 +1,60 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+)
+
+const (
+	SCHEDULER_INTERVAL = 15 * time.Second
+	// posts published per query; a busy tick keeps going until caught up
+	SCHEDULER_BATCH = 100
+)
+
+// Scheduler publishes the scheduled posts once they are due. Every replica
+// runs one; the repository makes sure a post is only published once.
+type Scheduler struct {
+	onPublished func(ctx context.Context, post *models.Post)
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// OnPublished registers the function called with every post the scheduler
+// publishes. It must be set before the scheduler runs.
+func (s *Scheduler) OnPublished(onPublished func(ctx context.Context, post *models.Post)) {
+	s.onPublished = onPublished
+}
+
+func (s *Scheduler) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.publishDuePosts()
+		<-ticker.C
+	}
+}
+
+func (s *Scheduler) publishDuePosts() {
+	ctx := context.Background()
+	for {
+		posts, err := repository.PublishDuePosts(ctx, SCHEDULER_BATCH)
+		if err != nil {
+			log.Println("scheduler:", err)
+			return
+		}
+		for _, post := range posts {
+			if s.onPublished != nil {
+				s.onPublished(ctx, post)
+			}
+		}
+		if len(posts) < SCHEDULER_BATCH {
+			return
+		}
+	}
+}
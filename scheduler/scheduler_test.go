@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+)
+
+// dueRepository publishes its due posts in batches of the requested limit,
+// failing once it has none left when err is set.
+type dueRepository struct {
+	repository.Repository
+	due     []*models.Post
+	err     error
+	queries int
+}
+
+func (repo *dueRepository) PublishDuePosts(ctx context.Context, limit int) ([]*models.Post, error) {
+	repo.queries++
+	if len(repo.due) == 0 && repo.err != nil {
+		return nil, repo.err
+	}
+	if limit > len(repo.due) {
+		limit = len(repo.due)
+	}
+	published := repo.due[:limit]
+	repo.due = repo.due[limit:]
+	for _, post := range published {
+		post.Status = models.POST_PUBLISHED
+	}
+	return published, nil
+}
+
+func scheduledPosts(count int) []*models.Post {
+	posts := make([]*models.Post, 0, count)
+	for i := 0; i < count; i++ {
+		posts = append(posts, &models.Post{Id: fmt.Sprint(i), Status: models.POST_SCHEDULED})
+	}
+	return posts
+}
+
+func TestPublishDuePosts(t *testing.T) {
+	for name, test := range map[string]struct {
+		due     int
+		err     error
+		queries int
+	}{
+		"nothing due":      {0, nil, 1},
+		"one batch":        {SCHEDULER_BATCH - 1, nil, 1},
+		"full batch":       {SCHEDULER_BATCH, nil, 2},
+		"several batches":  {2*SCHEDULER_BATCH + 1, nil, 3},
+		"error":            {0, errors.New("database is down"), 1},
+		"error after full": {SCHEDULER_BATCH, errors.New("database is down"), 2},
+	} {
+		repo := &dueRepository{due: scheduledPosts(test.due), err: test.err}
+		repository.SetRepository(repo)
+
+		published := []string{}
+		scheduler := NewScheduler()
+		scheduler.OnPublished(func(ctx context.Context, post *models.Post) {
+			if post.Status != models.POST_PUBLISHED {
+				t.Errorf("%s: post %s announced as %s", name, post.Id, post.Status)
+			}
+			published = append(published, post.Id)
+		})
+		scheduler.publishDuePosts()
+
+		if repo.queries != test.queries {
+			t.Errorf("%s: %d queries, want %d", name, repo.queries, test.queries)
+		}
+		want := []string{}
+		for _, post := range scheduledPosts(test.due) {
+			want = append(want, post.Id)
+		}
+		if !reflect.DeepEqual(published, want) {
+			t.Errorf("%s: announced %d posts, want %d", name, len(published), len(want))
+		}
+	}
+	repository.SetRepository(nil)
+}
+
+func TestPublishDuePostsWithoutListener(t *testing.T) {
+	repo := &dueRepository{due: scheduledPosts(3)}
+	repository.SetRepository(repo)
+	defer repository.SetRepository(nil)
+	NewScheduler().publishDuePosts()
+	if len(repo.due) != 0 {
+		t.Errorf("%d posts left unpublished", len(repo.due))
+	}
+}
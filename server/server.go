@@ -2,32 +2,82 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 
 	"github.com/adrisongomez/project-go/databases"
+	"github.com/adrisongomez/project-go/media"
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/moderation"
 	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/scheduler"
+	"github.com/adrisongomez/project-go/storage"
+	"github.com/adrisongomez/project-go/unfurl"
 	"github.com/adrisongomez/project-go/websockets"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	STORAGE_LOCAL = "local"
+	STORAGE_S3    = "s3"
+	// where the local blob store serves signed downloads
+	BLOBS_PATH = "/blobs"
+	// labels the key derived from JwtSecret when BlobSecret is not set
+	BLOB_SECRET_INFO = "blob-signing"
 )
 
 type Config struct {
-	Port        string
-	JwtSecret   string
-	DatabaseURL string
+	Port      string
+	JwtSecret string
+	// signs the URLs of the local blob store; a key derived from JwtSecret
+	// when empty, so that a leaked URL signature says nothing about tokens
+	BlobSecret       string
+	DatabaseURL      string
+	TimelineStrategy string
+	StorageDriver    string
+	StoragePath      string
+	S3               storage.S3Config
+	ModeratorIds     []string
+	// word and regex rules applied to posts, see moderation.Filter
+	FilterPath string
+	// posts are hidden once reported by this many users
+	AutoHideReports int
+}
+
+func (c *Config) IsModerator(userId string) bool {
+	for _, id := range c.ModeratorIds {
+		if id == userId {
+			return true
+		}
+	}
+	return false
 }
 
 type Server interface {
 	Config() *Config
 	Hub() *websockets.Hub
+	Storage() storage.BlobStore
+	Media() *media.Pipeline
+	Scheduler() *scheduler.Scheduler
+	Unfurler() *unfurl.Unfurler
+	Moderator() *moderation.Moderator
 }
 
 type Broker struct {
-	config *Config
-	router *mux.Router
-	hub    *websockets.Hub
+	config    *Config
+	router    *mux.Router
+	hub       *websockets.Hub
+	storage   storage.BlobStore
+	media     *media.Pipeline
+	scheduler *scheduler.Scheduler
+	unfurler  *unfurl.Unfurler
+	moderator *moderation.Moderator
 }
 
 func (b *Broker) Config() *Config {
@@ -44,14 +94,65 @@ func NewServer(ctx context.Context, config *Config) (*Broker, error) {
 	if config.DatabaseURL == "" {
 		return nil, errors.New("DatabaseURL is required")
 	}
+	if config.BlobSecret == "" {
+		secret, err := deriveSecret(config.JwtSecret, BLOB_SECRET_INFO)
+		if err != nil {
+			return nil, err
+		}
+		config.BlobSecret = secret
+	}
+	blobStore, err := newBlobStore(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.AutoHideReports <= 0 {
+		config.AutoHideReports = models.AUTO_HIDE_REPORTS
+	}
+	moderator := moderation.NewModerator()
+	if config.FilterPath != "" {
+		filter, err := moderation.LoadFilter(config.FilterPath)
+		if err != nil {
+			return nil, err
+		}
+		moderator.Use(filter)
+	}
 	broker := &Broker{
-		config: config,
-		router: mux.NewRouter(),
-		hub:    websockets.NewHub(),
+		config:    config,
+		router:    mux.NewRouter(),
+		hub:       websockets.NewHub(),
+		storage:   blobStore,
+		media:     media.NewPipeline(blobStore),
+		scheduler: scheduler.NewScheduler(),
+		unfurler:  unfurl.NewUnfurler(unfurl.UNFURL_WORKERS),
+		moderator: moderator,
 	}
 	return broker, nil
 }
 
+func newBlobStore(config *Config) (storage.BlobStore, error) {
+	switch config.StorageDriver {
+	case "", STORAGE_LOCAL:
+		path := config.StoragePath
+		if path == "" {
+			path = "uploads"
+		}
+		return storage.NewLocalBlobStore(path, BLOBS_PATH, config.BlobSecret)
+	case STORAGE_S3:
+		return storage.NewS3BlobStore(config.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage driver %q", config.StorageDriver)
+	}
+}
+
+// deriveSecret derives from secret a key of its own for the given use.
+func deriveSecret(secret string, info string) (string, error) {
+	key := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(info)), key); err != nil {
+		return "", err
+	}
+	return string(key), nil
+}
+
 func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
 	b.router = mux.NewRouter()
 	binder(b, b.router)
@@ -60,8 +161,25 @@ func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if err := repo.UseTimelineStrategy(b.config.TimelineStrategy); err != nil {
+		log.Fatal(err)
+	}
+	backplane, err := databases.NewPostgresBackplane(b.config.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b.hub.UseBackplane(backplane)
+	presence, err := databases.NewPostgresPresence(b.config.DatabaseURL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b.hub.UsePresenceStore(presence)
 	go b.hub.Run()
 	repository.SetRepository(repo)
+	b.media.Run(media.MEDIA_WORKERS)
+	go b.scheduler.Run(scheduler.SCHEDULER_INTERVAL)
+	b.unfurler.Run()
+	go scheduler.NewPurger(b.storage).Run(scheduler.PURGE_INTERVAL)
 	log.Println("Starting server on port", b.Config().Port)
 	if err := http.ListenAndServe(b.config.Port, handlers); err != nil {
 		log.Fatal("ListAndSere: ", err)
@@ -71,3 +189,23 @@ func (b *Broker) Start(binder func(s Server, r *mux.Router)) {
 func (b *Broker) Hub() *websockets.Hub {
 	return b.hub
 }
+
+func (b *Broker) Storage() storage.BlobStore {
+	return b.storage
+}
+
+func (b *Broker) Media() *media.Pipeline {
+	return b.media
+}
+
+func (b *Broker) Scheduler() *scheduler.Scheduler {
+	return b.scheduler
+}
+
+func (b *Broker) Unfurler() *unfurl.Unfurler {
+	return b.unfurler
+}
+
+func (b *Broker) Moderator() *moderation.Moderator {
+	return b.moderator
+}
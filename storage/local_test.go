@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocalStore(t *testing.T) *LocalBlobStore {
+	t.Helper()
+	store, err := NewLocalBlobStore(t.TempDir(), "/blobs/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestLocalBlobStoreRoundTrip(t *testing.T) {
+	store := newTestLocalStore(t)
+	ctx := context.Background()
+	key := "attachments/post/file.txt"
+
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "hello" {
+		t.Errorf("got %q, want hello", data)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("got %v after delete, want ErrBlobNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+}
+
+func TestLocalBlobStoreRejectsEscapingKeys(t *testing.T) {
+	store := newTestLocalStore(t)
+	for _, key := range []string{"", "../outside", "a/../../outside", "/absolute", "a//b", "a/./b"} {
+		if err := store.Put(context.Background(), key, strings.NewReader("x"), 1, "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := store.SignedURL(key, time.Minute); err == nil {
+			t.Errorf("SignedURL(%q) succeeded", key)
+		}
+	}
+}
+
+// serve requests a signed URL of store, mounted under /blobs as the server
+// does.
+func serve(store *LocalBlobStore, signedURL string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, signedURL, nil)
+	http.StripPrefix("/blobs", store).ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestLocalBlobStoreSignedURL(t *testing.T) {
+	store := newTestLocalStore(t)
+	key := "attachments/post/image.png"
+	if err := store.Put(context.Background(), key, strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := store.SignedURL(key, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, "/blobs/"+key+"?") {
+		t.Fatalf("unexpected url %s", signed)
+	}
+	response := serve(store, signed)
+	if response.Code != http.StatusOK || response.Body.String() != "png" {
+		t.Fatalf("got %d %q", response.Code, response.Body.String())
+	}
+	if got := response.Header().Get("Content-Type"); got != "image/png" {
+		t.Errorf("content type %q, want image/png", got)
+	}
+
+	u, _ := url.Parse(signed)
+	query := u.Query()
+	query.Set("signature", strings.Repeat("0", 64))
+	u.RawQuery = query.Encode()
+	if response := serve(store, u.String()); response.Code != http.StatusForbidden {
+		t.Errorf("tampered signature got %d", response.Code)
+	}
+
+	other, _ := NewLocalBlobStore(t.TempDir(), "/blobs", "other secret")
+	if response := serve(other, signed); response.Code != http.StatusForbidden {
+		t.Errorf("signature of another secret got %d", response.Code)
+	}
+
+	expired, err := store.SignedURL(key, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response := serve(store, expired); response.Code != http.StatusForbidden {
+		t.Errorf("expired link got %d", response.Code)
+	}
+}
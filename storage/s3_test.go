@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "us-east-1"
+	testBucket    = "attachments"
+)
+
+// fakeS3 is a stand-in for an S3 service keeping objects in memory. It
+// checks the SigV4 signature of every request on its own terms, both in the
+// Authorization header and in presigned query strings.
+type fakeS3 struct {
+	objects map[string][]byte
+	lock    sync.Mutex
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := verifySignature(r); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/"+testBucket+"/")
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[key] = data
+	case http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		if _, ok := f.objects[key]; !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func awsEscape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func verifySignature(r *http.Request) error {
+	query := r.URL.Query()
+	var credential, signedHeaders, signature, date, payload string
+	if query.Get("X-Amz-Signature") != "" {
+		credential = query.Get("X-Amz-Credential")
+		signedHeaders = query.Get("X-Amz-SignedHeaders")
+		signature = query.Get("X-Amz-Signature")
+		date = query.Get("X-Amz-Date")
+		payload = "UNSIGNED-PAYLOAD"
+		query.Del("X-Amz-Signature")
+		signedAt, err := time.Parse("20060102T150405Z", date)
+		if err != nil {
+			return err
+		}
+		expires, err := time.ParseDuration(query.Get("X-Amz-Expires") + "s")
+		if err != nil || time.Now().After(signedAt.Add(expires)) {
+			return errors.New("expired")
+		}
+	} else {
+		authorization := strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ")
+		for _, part := range strings.Split(authorization, ", ") {
+			name, value, _ := strings.Cut(part, "=")
+			switch name {
+			case "Credential":
+				credential = value
+			case "SignedHeaders":
+				signedHeaders = value
+			case "Signature":
+				signature = value
+			}
+		}
+		date = r.Header.Get("X-Amz-Date")
+		payload = r.Header.Get("X-Amz-Content-Sha256")
+	}
+	accessKey, scope, _ := strings.Cut(credential, "/")
+	if accessKey != testAccessKey {
+		return errors.New("unknown access key")
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, awsEscape(key)+"="+awsEscape(query.Get(key)))
+	}
+	var headers strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+	canonical := r.Method + "\n" + r.URL.EscapedPath() + "\n" + strings.Join(pairs, "&") + "\n" +
+		headers.String() + "\n" + signedHeaders + "\n" + payload
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range strings.Split(scope, "/") {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(stringToSign))
+	if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(signature)) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func newTestS3Store(t *testing.T) *S3BlobStore {
+	t.Helper()
+	server := httptest.NewServer(&fakeS3{objects: make(map[string][]byte)})
+	t.Cleanup(server.Close)
+	store, err := NewS3BlobStore(S3Config{
+		Endpoint:  server.URL,
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestS3BlobStoreRoundTrip(t *testing.T) {
+	store := newTestS3Store(t)
+	ctx := context.Background()
+
+	for _, key := range []string{"attachments/post/file.txt", "attachments/a post/ünïcode (1)+~.txt"} {
+		if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+			t.Fatalf("Put(%q): %v", key, err)
+		}
+		body, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", key, err)
+		}
+		data, _ := io.ReadAll(body)
+		body.Close()
+		if string(data) != "hello" {
+			t.Errorf("Get(%q) = %q, want hello", key, data)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			t.Fatalf("Delete(%q): %v", key, err)
+		}
+		if _, err := store.Get(ctx, key); !errors.Is(err, ErrBlobNotFound) {
+			t.Errorf("Get(%q) after delete: %v, want ErrBlobNotFound", key, err)
+		}
+		if err := store.Delete(ctx, key); err != nil {
+			t.Errorf("deleting missing %q: %v", key, err)
+		}
+	}
+}
+
+func TestS3BlobStoreRejectsWrongSecret(t *testing.T) {
+	store := newTestS3Store(t)
+	store.config.SecretKey = "wrong"
+	err := store.Put(context.Background(), "file.txt", strings.NewReader("x"), 1, "text/plain")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("got %v, want a 403", err)
+	}
+}
+
+func TestS3BlobStoreSignedURL(t *testing.T) {
+	store := newTestS3Store(t)
+	key := "attachments/a post/image.png"
+	if err := store.Put(context.Background(), key, strings.NewReader("png"), 3, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := store.SignedURL(key, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := http.Get(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(data) != "png" {
+		t.Fatalf("got %d %q", response.StatusCode, data)
+	}
+
+	tampered := strings.Replace(signed, "image.png", "other.png", 1)
+	response, err = http.Get(tampered)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("tampered url got %d", response.StatusCode)
+	}
+
+	long, _ := store.SignedURL(key, 30*24*time.Hour)
+	u, _ := url.Parse(long)
+	if got := u.Query().Get("X-Amz-Expires"); got != "604800" {
+		t.Errorf("expires %s, want the one week cap", got)
+	}
+}
@@ -0,0 +1,115 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+const (
+	FETCH_TIMEOUT = 5 * time.Second
+	DIAL_TIMEOUT  = 2 * time.Second
+	MAX_REDIRECTS = 3
+	// the metadata is in the head, the rest of the page is never read
+	MAX_PAGE_SIZE = 512 << 10
+	USER_AGENT    = "project-go-unfurl/1.0"
+)
+
+var (
+	ErrUnsupportedURL   = errors.New("only http and https links are unfurled")
+	ErrNotHTML          = errors.New("link is not an HTML page")
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// Fetcher retrieves link previews. It only connects to public addresses.
+type Fetcher struct {
+	client *http.Client
+}
+
+func NewFetcher() *Fetcher {
+	return newFetcher(IsPublicIP)
+}
+
+// newFetcher lets allowed decide which addresses may be dialed.
+func newFetcher(allowed func(net.IP) bool) *Fetcher {
+	dialer := &net.Dialer{
+		Timeout: DIAL_TIMEOUT,
+		Control: guardDial(allowed),
+	}
+	transport := &http.Transport{
+		// a proxy would be the one dialed, defeating the address checks
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   DIAL_TIMEOUT,
+		ResponseHeaderTimeout: FETCH_TIMEOUT,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &Fetcher{
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   FETCH_TIMEOUT,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				if len(via) > MAX_REDIRECTS {
+					return ErrTooManyRedirects
+				}
+				return checkURL(req.URL)
+			},
+		},
+	}
+}
+
+func checkURL(link *url.URL) error {
+	if (link.Scheme != "http" && link.Scheme != "https") || link.Host == "" {
+		return ErrUnsupportedURL
+	}
+	return nil
+}
+
+// Fetch reads the preview of the page at link. The preview keeps the link it
+// was asked for, even when the page was reached through redirects.
+func (f *Fetcher) Fetch(ctx context.Context, link string) (*models.LinkPreview, error) {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkURL(parsed); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", USER_AGENT)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", res.StatusCode)
+	}
+	mediaType, _, err := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return nil, ErrNotHTML
+	}
+
+	preview := parseMetadata(res.Request.URL, io.LimitReader(res.Body, MAX_PAGE_SIZE))
+	preview.URL = link
+	if preview.Title == "" {
+		return nil, errors.New("page has no title")
+	}
+	preview.FetchedAt = time.Now().UTC()
+	return preview, nil
+}
@@ -0,0 +1,164 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newTestFetcher reaches the loopback test servers, and nothing else that is
+// not public.
+func newTestFetcher() *Fetcher {
+	return newFetcher(func(ip net.IP) bool {
+		return ip.IsLoopback() || IsPublicIP(ip)
+	})
+}
+
+func TestIsPublicIP(t *testing.T) {
+	for address, want := range map[string]bool{
+		"93.184.216.34":   true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"255.255.255.255": false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"64:ff9b::a00:1":  false,
+		"::ffff:10.0.0.1": false,
+	} {
+		if got := IsPublicIP(net.ParseIP(address)); got != want {
+			t.Errorf("IsPublicIP(%s) = %v, want %v", address, got, want)
+		}
+	}
+}
+
+func TestFetchFollowsRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/short" {
+			http.Redirect(w, r, "/article", http.StatusFound)
+			return
+		}
+		if got := r.Header.Get("User-Agent"); got != USER_AGENT {
+			t.Errorf("user agent %q", got)
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(`<html><head><title>Article</title><meta property="og:image" content="/cover.png"></head></html>`))
+	}))
+	defer server.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), server.URL+"/short")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.URL != server.URL+"/short" {
+		t.Errorf("url %s, want the link asked for", preview.URL)
+	}
+	if preview.Title != "Article" {
+		t.Errorf("title %q", preview.Title)
+	}
+	// relative to the page the redirects led to
+	if preview.ImageURL != server.URL+"/cover.png" {
+		t.Errorf("image %s", preview.ImageURL)
+	}
+	if preview.FetchedAt.IsZero() {
+		t.Error("fetched at is not set")
+	}
+}
+
+func TestFetchRefusesRedirectToPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher().Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchRefusesPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the server was reached")
+	}))
+	defer server.Close()
+
+	_, err := NewFetcher().Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("got %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestFetchRefusesTooManyRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Path+"x", http.StatusFound)
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher().Fetch(context.Background(), server.URL+"/")
+	if !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("got %v, want ErrTooManyRedirects", err)
+	}
+}
+
+func TestFetchRefusesUnsupportedURL(t *testing.T) {
+	for _, link := range []string{"ftp://example.com/file", "file:///etc/passwd", "javascript:alert(1)", "//example.com"} {
+		if _, err := newTestFetcher().Fetch(context.Background(), link); !errors.Is(err, ErrUnsupportedURL) {
+			t.Errorf("Fetch(%s) = %v, want ErrUnsupportedURL", link, err)
+		}
+	}
+}
+
+func TestFetchRefusesNonHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"title": "not a page"}`))
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher().Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrNotHTML) {
+		t.Errorf("got %v, want ErrNotHTML", err)
+	}
+}
+
+func TestFetchRefusesErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<title>Not found</title>`))
+	}))
+	defer server.Close()
+
+	if _, err := newTestFetcher().Fetch(context.Background(), server.URL); err == nil {
+		t.Error("a 404 page was unfurled")
+	}
+}
+
+func TestFetchReadsAtMostMaxPageSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Early</title><!--`))
+		w.Write([]byte(strings.Repeat("x", MAX_PAGE_SIZE)))
+		w.Write([]byte(`--><meta property="og:title" content="Late"></head></html>`))
+	}))
+	defer server.Close()
+
+	preview, err := newTestFetcher().Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Title != "Early" {
+		t.Errorf("title %q, want the one within the size cap", preview.Title)
+	}
+}
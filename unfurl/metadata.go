@@ -0,0 +1,110 @@
+package unfurl
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/adrisongomez/project-go/models"
+	"golang.org/x/net/html"
+)
+
+const (
+	MAX_TITLE_LENGTH       = 300
+	MAX_DESCRIPTION_LENGTH = 1000
+	MAX_IMAGE_URL_LENGTH   = 2048
+)
+
+// parseMetadata reads the OpenGraph and Twitter card tags of a page, falling
+// back to its <title> and description. It stops at the end of the head.
+func parseMetadata(page *url.URL, body io.Reader) *models.LinkPreview {
+	properties := make(map[string]string)
+	var title string
+	inTitle := false
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return buildPreview(page, properties, title)
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(tokenizer.Text())
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				return buildPreview(page, properties, title)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttributes := tokenizer.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = true
+			case "body":
+				return buildPreview(page, properties, title)
+			case "meta":
+				var key, content string
+				for hasAttributes {
+					var attribute, value []byte
+					attribute, value, hasAttributes = tokenizer.TagAttr()
+					switch string(attribute) {
+					case "property", "name":
+						key = strings.ToLower(string(value))
+					case "content":
+						content = string(value)
+					}
+				}
+				// the first occurrence of a property wins
+				if _, ok := properties[key]; key != "" && !ok {
+					properties[key] = content
+				}
+			}
+		}
+	}
+}
+
+func buildPreview(page *url.URL, properties map[string]string, title string) *models.LinkPreview {
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := strings.TrimSpace(properties[key]); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	preview := &models.LinkPreview{
+		URL:         page.String(),
+		Title:       first("og:title", "twitter:title"),
+		Description: first("og:description", "twitter:description", "description"),
+		SiteName:    first("og:site_name"),
+	}
+	if preview.Title == "" {
+		preview.Title = strings.TrimSpace(title)
+	}
+	preview.Title = truncate(strings.Join(strings.Fields(preview.Title), " "), MAX_TITLE_LENGTH)
+	preview.Description = truncate(strings.Join(strings.Fields(preview.Description), " "), MAX_DESCRIPTION_LENGTH)
+	preview.SiteName = truncate(preview.SiteName, MAX_TITLE_LENGTH)
+
+	if image := first("og:image:secure_url", "og:image", "twitter:image", "twitter:image:src"); image != "" {
+		// images are only linked, never fetched, but must still be web URLs
+		if resolved, err := page.Parse(image); err == nil &&
+			(resolved.Scheme == "http" || resolved.Scheme == "https") &&
+			len(resolved.String()) <= MAX_IMAGE_URL_LENGTH {
+			preview.ImageURL = resolved.String()
+		}
+	}
+	return preview
+}
+
+func truncate(value string, length int) string {
+	if utf8.RuneCountInString(value) <= length {
+		return value
+	}
+	return string([]rune(value)[:length])
+}
@@ -0,0 +1,121 @@
+package unfurl
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func parse(t *testing.T, page string) *models.LinkPreview {
+	t.Helper()
+	link, _ := url.Parse("https://example.com/blog/post")
+	return parseMetadata(link, strings.NewReader(page))
+}
+
+func TestParseMetadataPrefersOpenGraph(t *testing.T) {
+	preview := parse(t, `<html><head>
+		<title>Page title</title>
+		<meta name="description" content="Page description">
+		<meta name="twitter:title" content="Twitter title">
+		<meta name="twitter:description" content="Twitter description">
+		<meta name="twitter:image" content="https://cdn.example.com/twitter.png">
+		<meta property="og:title" content="OG title">
+		<meta property="og:title" content="Second OG title">
+		<meta property="og:description" content="OG description">
+		<meta property="og:site_name" content="Example">
+		<meta property="og:image" content="https://cdn.example.com/og.png">
+	</head></html>`)
+
+	want := models.LinkPreview{
+		URL:         "https://example.com/blog/post",
+		Title:       "OG title",
+		Description: "OG description",
+		SiteName:    "Example",
+		ImageURL:    "https://cdn.example.com/og.png",
+	}
+	if *preview != want {
+		t.Errorf("got %+v, want %+v", *preview, want)
+	}
+}
+
+func TestParseMetadataFallsBackToTwitter(t *testing.T) {
+	preview := parse(t, `<head>
+		<title>Page title</title>
+		<meta name="description" content="Page description">
+		<meta name="Twitter:Title" content="Twitter title">
+		<meta name="twitter:description" content="Twitter description">
+		<meta name="twitter:image:src" content="images/card.png">
+	</head>`)
+
+	if preview.Title != "Twitter title" {
+		t.Errorf("title %q", preview.Title)
+	}
+	if preview.Description != "Twitter description" {
+		t.Errorf("description %q", preview.Description)
+	}
+	if preview.ImageURL != "https://example.com/blog/images/card.png" {
+		t.Errorf("image %s", preview.ImageURL)
+	}
+}
+
+func TestParseMetadataFallsBackToTitle(t *testing.T) {
+	preview := parse(t, `<head>
+		<title>
+			Page
+			title
+		</title>
+		<meta property="og:title" content="  ">
+		<meta name="description" content="Page description">
+	</head>`)
+
+	if preview.Title != "Page title" {
+		t.Errorf("title %q", preview.Title)
+	}
+	if preview.Description != "Page description" {
+		t.Errorf("description %q", preview.Description)
+	}
+	if preview.ImageURL != "" {
+		t.Errorf("image %s", preview.ImageURL)
+	}
+}
+
+func TestParseMetadataStopsAtBody(t *testing.T) {
+	preview := parse(t, `<html><body>
+		<title>In the body</title>
+		<meta property="og:title" content="In the body">
+	</body></html>`)
+
+	if preview.Title != "" {
+		t.Errorf("title %q, want none", preview.Title)
+	}
+}
+
+func TestParseMetadataDropsNonWebImages(t *testing.T) {
+	for _, image := range []string{"javascript:alert(1)", "data:image/png;base64,AAAA", "ftp://example.com/image.png"} {
+		preview := parse(t, `<head><title>Page</title><meta property="og:image" content="`+image+`"></head>`)
+		if preview.ImageURL != "" {
+			t.Errorf("image %s was kept", preview.ImageURL)
+		}
+	}
+}
+
+func TestParseMetadataTruncates(t *testing.T) {
+	preview := parse(t, `<head>
+		<title>`+strings.Repeat("é", MAX_TITLE_LENGTH+10)+`</title>
+		<meta name="description" content="`+strings.Repeat("a ", MAX_DESCRIPTION_LENGTH)+`">
+		<meta property="og:image" content="https://example.com/`+strings.Repeat("a", MAX_IMAGE_URL_LENGTH)+`">
+	</head>`)
+
+	if got := utf8.RuneCountInString(preview.Title); got != MAX_TITLE_LENGTH {
+		t.Errorf("title of %d characters", got)
+	}
+	if got := utf8.RuneCountInString(preview.Description); got != MAX_DESCRIPTION_LENGTH {
+		t.Errorf("description of %d characters", got)
+	}
+	if preview.ImageURL != "" {
+		t.Error("an overlong image url was kept")
+	}
+}
@@ -0,0 +1,123 @@
+package unfurl
+
+import (
+	"context"
+	"hash/fnv"
+	"log"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/repository"
+	"github.com/adrisongomez/project-go/utils"
+)
+
+const (
+	UNFURL_WORKERS    = 4
+	UNFURL_QUEUE_SIZE = 256
+	// a whole post, every link included
+	UNFURL_TIMEOUT = 30 * time.Second
+)
+
+type job struct {
+	PostId string
+	URLs   []string
+}
+
+// Unfurler fetches the previews of the links in posts in the background.
+type Unfurler struct {
+	fetcher    *Fetcher
+	queues     []chan *job
+	onUnfurled func(postId string, previews []*models.LinkPreview)
+}
+
+func NewUnfurler(workers int) *Unfurler {
+	queues := make([]chan *job, workers)
+	for i := range queues {
+		queues[i] = make(chan *job, UNFURL_QUEUE_SIZE)
+	}
+	return &Unfurler{
+		fetcher: NewFetcher(),
+		queues:  queues,
+	}
+}
+
+// OnUnfurled registers the function called when the previews of a post have
+// changed. It must be set before the unfurler runs.
+func (u *Unfurler) OnUnfurled(onUnfurled func(postId string, previews []*models.LinkPreview)) {
+	u.onUnfurled = onUnfurled
+}
+
+func (u *Unfurler) Run() {
+	for _, queue := range u.queues {
+		go u.work(queue)
+	}
+}
+
+// Enqueue schedules the links of post for unfurling. The jobs of a post
+// always go to the same worker, so an older edit cannot overwrite the
+// previews of a newer one.
+func (u *Unfurler) Enqueue(post *models.Post) {
+	urls := utils.ExtractURLs(post.PostContent)
+	if len(urls) > models.MAX_PREVIEWS_PER_POST {
+		urls = urls[:models.MAX_PREVIEWS_PER_POST]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(post.Id))
+	select {
+	case u.queues[hash.Sum32()%uint32(len(u.queues))] <- &job{PostId: post.Id, URLs: urls}:
+	default:
+		log.Println("unfurl: queue is full, skipping", post.Id)
+	}
+}
+
+func (u *Unfurler) work(queue chan *job) {
+	for job := range queue {
+		ctx, cancel := context.WithTimeout(context.Background(), UNFURL_TIMEOUT)
+		previews, changed, err := u.unfurl(ctx, job)
+		cancel()
+		if err != nil {
+			log.Println("unfurl:", job.PostId, err)
+			continue
+		}
+		if changed && u.onUnfurled != nil {
+			u.onUnfurled(job.PostId, previews)
+		}
+	}
+}
+
+// unfurl fetches the links missing from the cache or gone stale, keeping the
+// stale preview when the page cannot be fetched again.
+func (u *Unfurler) unfurl(ctx context.Context, job *job) ([]*models.LinkPreview, bool, error) {
+	cached, err := repository.GetLinkPreviews(ctx, job.URLs)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fetched := false
+	previews := make([]*models.LinkPreview, 0, len(job.URLs))
+	urls := make([]string, 0, len(job.URLs))
+	for _, url := range job.URLs {
+		preview := cached[url]
+		if preview == nil || time.Since(preview.FetchedAt) > models.LINK_PREVIEW_TTL {
+			fresh, err := u.fetcher.Fetch(ctx, url)
+			if err != nil {
+				log.Println("unfurl:", url, err)
+			} else if err := repository.SaveLinkPreview(ctx, fresh); err != nil {
+				return nil, false, err
+			} else {
+				preview = fresh
+				fetched = true
+			}
+		}
+		if preview != nil {
+			previews = append(previews, preview)
+			urls = append(urls, url)
+		}
+	}
+
+	replaced, err := repository.ReplacePostPreviews(ctx, job.PostId, urls)
+	if err != nil {
+		return nil, false, err
+	}
+	return previews, replaced || fetched, nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const (
+	cursorForward  = "n"
+	cursorBackward = "p"
+)
+
+// EncodeCursor turns the position into an opaque token clients hand back to
+// fetch the next page.
+func EncodeCursor(cursor *models.PostCursor) string {
+	direction := cursorForward
+	if cursor.Backward {
+		direction = cursorBackward
+	}
+	raw := direction + ":" + strconv.FormatInt(cursor.CreatedAt.UnixNano(), 10) + ":" + cursor.Id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(token string) (*models.PostCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, ErrInvalidCursor
+	}
+	if parts[0] != cursorForward && parts[0] != cursorBackward {
+		return nil, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &models.PostCursor{
+		CreatedAt: time.Unix(0, nanos).UTC(),
+		Id:        parts[2],
+		Backward:  parts[0] == cursorBackward,
+	}, nil
+}
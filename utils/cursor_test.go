@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, cursor := range []models.PostCursor{
+		{CreatedAt: time.Date(2024, 3, 1, 12, 30, 0, 123456789, time.UTC), Id: "2aBcD3eFgHiJkLmNoPqRsTuVwXy"},
+		{CreatedAt: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC), Id: "with:colons", Backward: true},
+	} {
+		token := EncodeCursor(&cursor)
+		decoded, err := DecodeCursor(token)
+		if err != nil {
+			t.Fatalf("DecodeCursor(%s): %v", token, err)
+		}
+		if !decoded.CreatedAt.Equal(cursor.CreatedAt) || decoded.Id != cursor.Id || decoded.Backward != cursor.Backward {
+			t.Errorf("got %+v, want %+v", *decoded, cursor)
+		}
+	}
+}
+
+func TestDecodeCursorRejectsInvalidTokens(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+	for _, token := range []string{
+		"",
+		"not base64!",
+		encode("n:123"),
+		encode("n:123:"),
+		encode("x:123:id"),
+		encode("n:yesterday:id"),
+		encode("n:99999999999999999999:id"),
+	} {
+		if _, err := DecodeCursor(token); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", token, err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"regexp"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// bounds the memory the longest common subsequence table may take
+const MAX_DIFF_CELLS = 1 << 20
+
+var (
+	wordPattern = regexp.MustCompile(`\s+|\S+`)
+	linePattern = regexp.MustCompile(`[^\n]*\n|[^\n]+`)
+)
+
+// Diff returns the chunks turning before into after, word by word. Texts too
+// long for that are compared line by line, and as a whole past that.
+// Concatenating the equal and insert chunks gives after back.
+func Diff(before, after string) []models.DiffChunk {
+	a, b := wordPattern.FindAllString(before, -1), wordPattern.FindAllString(after, -1)
+	if (len(a)+1)*(len(b)+1) > MAX_DIFF_CELLS {
+		a, b = linePattern.FindAllString(before, -1), linePattern.FindAllString(after, -1)
+	}
+	if (len(a)+1)*(len(b)+1) > MAX_DIFF_CELLS {
+		a, b = []string{before}, []string{after}
+	}
+
+	// lengths[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lengths := make([][]int, len(a)+1)
+	for i := range lengths {
+		lengths[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lengths[i][j] = lengths[i+1][j+1] + 1
+			} else if lengths[i+1][j] >= lengths[i][j+1] {
+				lengths[i][j] = lengths[i+1][j]
+			} else {
+				lengths[i][j] = lengths[i][j+1]
+			}
+		}
+	}
+
+	chunks := make([]models.DiffChunk, 0)
+	add := func(op string, text string) {
+		if text == "" {
+			return
+		}
+		if n := len(chunks); n > 0 && chunks[n-1].Op == op {
+			chunks[n-1].Text += text
+			return
+		}
+		chunks = append(chunks, models.DiffChunk{Op: op, Text: text})
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			add(models.DIFF_EQUAL, a[i])
+			i, j = i+1, j+1
+		case lengths[i+1][j] >= lengths[i][j+1]:
+			add(models.DIFF_DELETE, a[i])
+			i++
+		default:
+			add(models.DIFF_INSERT, b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		add(models.DIFF_DELETE, a[i])
+	}
+	for ; j < len(b); j++ {
+		add(models.DIFF_INSERT, b[j])
+	}
+	return chunks
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// join concatenates the chunks of the given operations.
+func join(chunks []models.DiffChunk, ops ...string) string {
+	var text strings.Builder
+	for _, chunk := range chunks {
+		for _, op := range ops {
+			if chunk.Op == op {
+				text.WriteString(chunk.Text)
+			}
+		}
+	}
+	return text.String()
+}
+
+func checkDiff(t *testing.T, before, after string, chunks []models.DiffChunk) {
+	t.Helper()
+	if got := join(chunks, models.DIFF_EQUAL, models.DIFF_DELETE); got != before {
+		t.Errorf("equal and delete chunks give %q, want %q", got, before)
+	}
+	if got := join(chunks, models.DIFF_EQUAL, models.DIFF_INSERT); got != after {
+		t.Errorf("equal and insert chunks give %q, want %q", got, after)
+	}
+	for i := 1; i < len(chunks); i++ {
+		if chunks[i].Op == chunks[i-1].Op {
+			t.Errorf("consecutive %s chunks were not merged", chunks[i].Op)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	equal := func(text string) models.DiffChunk { return models.DiffChunk{Op: models.DIFF_EQUAL, Text: text} }
+	insert := func(text string) models.DiffChunk { return models.DiffChunk{Op: models.DIFF_INSERT, Text: text} }
+	remove := func(text string) models.DiffChunk { return models.DiffChunk{Op: models.DIFF_DELETE, Text: text} }
+
+	for _, test := range []struct {
+		before, after string
+		want          []models.DiffChunk
+	}{
+		{"", "", []models.DiffChunk{}},
+		{"same text", "same text", []models.DiffChunk{equal("same text")}},
+		{"", "new post", []models.DiffChunk{insert("new post")}},
+		{"old post", "", []models.DiffChunk{remove("old post")}},
+		{"the quick fox", "the slow fox", []models.DiffChunk{equal("the "), remove("quick"), insert("slow"), equal(" fox")}},
+		{"hello world", "hello big world", []models.DiffChunk{equal("hello "), insert("big "), equal("world")}},
+		{"a b c", "a c", []models.DiffChunk{equal("a "), remove("b "), equal("c")}},
+		{"one\ntwo", "one two", []models.DiffChunk{equal("one"), remove("\n"), insert(" "), equal("two")}},
+	} {
+		got := Diff(test.before, test.after)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Diff(%q, %q) = %v, want %v", test.before, test.after, got, test.want)
+		}
+		checkDiff(t, test.before, test.after, got)
+	}
+}
+
+func TestDiffFallsBackToLines(t *testing.T) {
+	line := strings.Repeat("word ", 100) + "\n"
+	before := strings.Repeat(line, 20)
+	after := strings.Replace(before, line, "changed line\n", 1)
+
+	chunks := Diff(before, after)
+	checkDiff(t, before, after, chunks)
+	want := []models.DiffChunk{
+		{Op: models.DIFF_DELETE, Text: line},
+		{Op: models.DIFF_INSERT, Text: "changed line\n"},
+		{Op: models.DIFF_EQUAL, Text: strings.Repeat(line, 19)},
+	}
+	if !reflect.DeepEqual(chunks, want) {
+		t.Errorf("got %d chunks, want whole lines", len(chunks))
+	}
+}
+
+func TestDiffFallsBackToWholeText(t *testing.T) {
+	before := strings.Repeat("line\n", 2000)
+	after := before + "last\n"
+
+	chunks := Diff(before, after)
+	checkDiff(t, before, after, chunks)
+	if len(chunks) != 2 || chunks[0].Op != models.DIFF_DELETE || chunks[1].Op != models.DIFF_INSERT {
+		t.Errorf("got %d chunks, want the whole texts", len(chunks))
+	}
+}
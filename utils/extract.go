@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// a tag or mention must not be glued to a preceding word, so emails and
+	// anchors such as "a@b.com" or "page#top" are skipped
+	tagPattern     = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&@#])#([\p{L}\p{N}_]{1,64})`)
+	mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_.@#])@([A-Za-z0-9_]{3,32})`)
+	HandlePattern  = regexp.MustCompile(`^[A-Za-z0-9_]{3,32}$`)
+	// trailing punctuation is left out, as in "see https://example.com."
+	urlPattern = regexp.MustCompile(`https?://[^\s<>"']+[^\s<>"'.,;:!?)\]]`)
+)
+
+// ExtractTags returns the distinct #tags in content, lowercased, in order of
+// appearance.
+func ExtractTags(content string) []string {
+	return extract(tagPattern, content)
+}
+
+// ExtractMentions returns the distinct @handles in content, lowercased, in
+// order of appearance.
+func ExtractMentions(content string) []string {
+	return extract(mentionPattern, content)
+}
+
+// ExtractURLs returns the distinct http and https links in content, in order
+// of appearance.
+func ExtractURLs(content string) []string {
+	seen := make(map[string]bool)
+	found := make([]string, 0)
+	for _, url := range urlPattern.FindAllString(content, -1) {
+		if seen[url] {
+			continue
+		}
+		seen[url] = true
+		found = append(found, url)
+	}
+	return found
+}
+
+func extract(pattern *regexp.Regexp, content string) []string {
+	seen := make(map[string]bool)
+	found := make([]string, 0)
+	for _, match := range pattern.FindAllStringSubmatch(content, -1) {
+		value := strings.ToLower(match[1])
+		if seen[value] {
+			continue
+		}
+		seen[value] = true
+		found = append(found, value)
+	}
+	return found
+}
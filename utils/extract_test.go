@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractTags(t *testing.T) {
+	for content, want := range map[string][]string{
+		"":                                 {},
+		"no tags here":                     {},
+		"#Go is fun, #go and #golang":      {"go", "golang"},
+		"(#first) #second. #third,#fourth": {"first", "second", "third", "fourth"},
+		"#café #日本":                        {"café", "日本"},
+		"page#top &#39; @#x a##b":          {},
+		"#under_score_1":                   {"under_score_1"},
+	} {
+		if got := ExtractTags(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractTags(%q) = %v, want %v", content, got, want)
+		}
+	}
+}
+
+func TestExtractMentions(t *testing.T) {
+	for content, want := range map[string][]string{
+		"":                               {},
+		"hi @Alice and @alice, @bob_99!": {"alice", "bob_99"},
+		"(@carol) @dave.":                {"carol", "dave"},
+		"mail me at me@example.com":      {},
+		"@ab is too short":               {},
+		"me.@eve #@frank @@grace":        {},
+	} {
+		if got := ExtractMentions(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractMentions(%q) = %v, want %v", content, got, want)
+		}
+	}
+}
+
+func TestHandlePattern(t *testing.T) {
+	for handle, want := range map[string]bool{
+		"alice":                             true,
+		"bob_99":                            true,
+		"ab":                                false,
+		"thirty_three_characters_long_xyzw": false,
+		"with space":                        false,
+		"dot.ted":                           false,
+	} {
+		if got := HandlePattern.MatchString(handle); got != want {
+			t.Errorf("HandlePattern matches %q: %v, want %v", handle, got, want)
+		}
+	}
+}
+
+func TestExtractURLs(t *testing.T) {
+	for content, want := range map[string][]string{
+		"":                         {},
+		"see https://example.com.": {"https://example.com"},
+		"(http://a.example/x?y=1), https://b.example/a_b and https://b.example/a_b!": {
+			"http://a.example/x?y=1",
+			"https://b.example/a_b",
+		},
+		`<a href="https://c.example/page">`:                 {"https://c.example/page"},
+		"ftp://d.example and javascript:alert(1) www.e.com": {},
+	} {
+		if got := ExtractURLs(content); !reflect.DeepEqual(got, want) {
+			t.Errorf("ExtractURLs(%q) = %v, want %v", content, got, want)
+		}
+	}
+}
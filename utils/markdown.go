@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"bytes"
+	"html"
+	"strings"
+
+	"github.com/adrisongomez/project-go/models"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+var (
+	// raw HTML in the source is escaped by goldmark, the policy then keeps
+	// only the elements of the supported subset
+	markdown = goldmark.New(goldmark.WithExtensions(extension.Strikethrough, extension.Linkify))
+	postHTML = newPostPolicy()
+)
+
+func newPostPolicy() *bluemonday.Policy {
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements(
+		"p", "br", "hr", "strong", "em", "del", "code", "pre", "blockquote",
+		"ul", "ol", "li", "h1", "h2", "h3", "h4", "h5", "h6",
+	)
+	policy.AllowAttrs("start").Matching(bluemonday.Integer).OnElements("ol")
+	policy.AllowAttrs("href").OnElements("a")
+	policy.AllowStandardURLs()
+	policy.RequireNoFollowOnLinks(true)
+	return policy
+}
+
+// RenderPost turns the content of a post into sanitized HTML. Plain text is
+// escaped and keeps its line breaks.
+func RenderPost(content string, format string) (string, error) {
+	if format != models.POST_FORMAT_MARKDOWN {
+		paragraphs := strings.Split(strings.ReplaceAll(content, "\r\n", "\n"), "\n\n")
+		var rendered strings.Builder
+		for _, paragraph := range paragraphs {
+			if strings.TrimSpace(paragraph) == "" {
+				continue
+			}
+			rendered.WriteString("<p>")
+			rendered.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+			rendered.WriteString("</p>")
+		}
+		return rendered.String(), nil
+	}
+
+	var rendered bytes.Buffer
+	if err := markdown.Convert([]byte(content), &rendered); err != nil {
+		return "", err
+	}
+	return postHTML.Sanitize(rendered.String()), nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func TestRenderPostMarkdown(t *testing.T) {
+	for content, want := range map[string]string{
+		"**bold** _em_ ~~del~~ `code`":        `<p><strong>bold</strong> <em>em</em> <del>del</del> <code>code</code></p>`,
+		"# Title\n\n> quote":                  "<h1>Title</h1>\n<blockquote>\n<p>quote</p>\n</blockquote>",
+		"3. three\n4. four":                   "<ol start=\"3\">\n<li>three</li>\n<li>four</li>\n</ol>",
+		"[link](https://example.com)":         `<p><a href="https://example.com" rel="nofollow">link</a></p>`,
+		"see https://example.com/auto":        `<p>see <a href="https://example.com/auto" rel="nofollow">https://example.com/auto</a></p>`,
+		"<script>alert(1)</script>":           ``,
+		"<img src=x onerror=alert(1)>":        ``,
+		`<a href="https://x" onclick="y">z`:   `<p>z</p>`,
+		"[x](javascript:alert(1))":            `<p>x</p>`,
+		"[x](data:text/html;base64,AAAA)":     `<p>x</p>`,
+		"![image](https://example.com/a.png)": `<p></p>`,
+	} {
+		got, err := RenderPost(content, models.POST_FORMAT_MARKDOWN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got = strings.TrimSpace(got); got != want {
+			t.Errorf("RenderPost(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+func TestRenderPostPlain(t *testing.T) {
+	for content, want := range map[string]string{
+		"":                                   ``,
+		"**not markdown**":                   `<p>**not markdown**</p>`,
+		"<script>alert(1)</script>":          `<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>`,
+		"first\r\nline\n\n\n\nsecond & more": `<p>first<br>line</p><p>second &amp; more</p>`,
+	} {
+		got, err := RenderPost(content, models.POST_FORMAT_PLAIN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("RenderPost(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package websockets
+
+import "sync"
+
+// Backplane fans hub messages out to every server instance so clients
+// connected to other replicas receive them too. The publishing hub receives
+// its own messages back like any other, so every instance delivers them the
+// same way.
+//
+// Sequenced payloads are numbered from a sequence shared by every instance
+// and reach each subscriber in that order, which is what lets a client
+// resume from its last event id on any replica. The others arrive with id 0.
+type Backplane interface {
+	Publish(payload []byte, sequenced bool) error
+	// onGap is called when sequenced payloads were lost, before the payloads
+	// that follow them are handed to handler
+	Subscribe(handler func(id uint64, payload []byte), onGap func())
+	Close() error
+}
+
+// LocalBackplane is an in-process Backplane. Hubs sharing one instance behave
+// like replicas sharing a database, which is handy for tests, and a hub on
+// its own relays its messages through a private one. Nothing is ever lost,
+// so it never reports a gap.
+type LocalBackplane struct {
+	lastId      uint64
+	subscribers []*localSubscriber
+	lock        *sync.Mutex
+}
+
+type localPayload struct {
+	id      uint64
+	payload []byte
+}
+
+// localSubscriber queues the payloads of a subscriber, guarded by the lock
+// of the backplane, until its goroutine hands them to the handler. Publish
+// never waits for a subscriber, so a hub may publish from the goroutine
+// that consumes its own payloads.
+type localSubscriber struct {
+	queue  []localPayload
+	notify chan struct{}
+	closed bool
+}
+
+func NewLocalBackplane() *LocalBackplane {
+	return &LocalBackplane{
+		subscribers: make([]*localSubscriber, 0),
+		lock:        &sync.Mutex{},
+	}
+}
+
+func (b *LocalBackplane) Publish(payload []byte, sequenced bool) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var id uint64
+	if sequenced {
+		b.lastId++
+		id = b.lastId
+	}
+	// queued under the lock so every subscriber sees the same order
+	for _, subscriber := range b.subscribers {
+		subscriber.queue = append(subscriber.queue, localPayload{id: id, payload: payload})
+		subscriber.wake()
+	}
+	return nil
+}
+
+func (s *localSubscriber) wake() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+		// already woken, the queue is taken as a whole
+	}
+}
+
+func (b *LocalBackplane) Subscribe(handler func(id uint64, payload []byte), onGap func()) {
+	subscriber := &localSubscriber{notify: make(chan struct{}, 1)}
+	b.lock.Lock()
+	b.subscribers = append(b.subscribers, subscriber)
+	b.lock.Unlock()
+
+	go func() {
+		for range subscriber.notify {
+			b.lock.Lock()
+			queue, closed := subscriber.queue, subscriber.closed
+			subscriber.queue = nil
+			b.lock.Unlock()
+
+			for _, p := range queue {
+				handler(p.id, p.payload)
+			}
+			if closed {
+				return
+			}
+		}
+	}()
+}
+
+// Close stops the subscribers once they handled the payloads already
+// published.
+func (b *LocalBackplane) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, subscriber := range b.subscribers {
+		subscriber.closed = true
+		subscriber.wake()
+	}
+	b.subscribers = nil
+	return nil
+}
@@ -0,0 +1,200 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+const receiveTimeout = time.Second
+
+func newTestHub(backplane Backplane) *Hub {
+	hub := NewHub()
+	hub.UseBackplane(backplane)
+	go hub.Run()
+	return hub
+}
+
+func connect(hub *Hub, userId string, lastEventId *uint64) *Client {
+	client := newClient(hub, "test")
+	client.userId = userId
+	client.lastEventId = lastEventId
+	hub.register <- client
+	return client
+}
+
+// receive returns the next message queued for client, skipping presence
+// updates.
+func receive(t *testing.T, client *Client) models.WebsocketMessage {
+	t.Helper()
+	for {
+		select {
+		case e := <-client.outbound:
+			var message models.WebsocketMessage
+			if err := json.Unmarshal(e.message.json, &message); err != nil {
+				t.Fatal(err)
+			}
+			if message.Type == models.PRESENCE_ONLINE || message.Type == models.PRESENCE_OFFLINE {
+				continue
+			}
+			return message
+		case <-time.After(receiveTimeout):
+			t.Fatal("no message received")
+		}
+	}
+}
+
+func TestBackplaneFanOut(t *testing.T) {
+	backplane := NewLocalBackplane()
+	first, second := newTestHub(backplane), newTestHub(backplane)
+	a, b := connect(first, "", nil), connect(second, "", nil)
+
+	first.Broadcast(models.WebsocketMessage{Type: "test"}, nil)
+
+	got, other := receive(t, a), receive(t, b)
+	if got.Type != "test" || other.Type != "test" {
+		t.Fatalf("got %q and %q", got.Type, other.Type)
+	}
+	if got.Id == 0 || got.Id != other.Id {
+		t.Errorf("event ids %d and %d, want the same one", got.Id, other.Id)
+	}
+}
+
+func TestBackplaneSkipsIgnoredClient(t *testing.T) {
+	backplane := NewLocalBackplane()
+	first, second := newTestHub(backplane), newTestHub(backplane)
+	a, b := connect(first, "", nil), connect(second, "", nil)
+
+	first.Broadcast(models.WebsocketMessage{Type: "ignored"}, a)
+	first.Broadcast(models.WebsocketMessage{Type: "next"}, nil)
+
+	if got := receive(t, a); got.Type != "next" {
+		t.Errorf("sender got %q, want next", got.Type)
+	}
+	if got := receive(t, b); got.Type != "ignored" {
+		t.Errorf("other hub got %q, want ignored", got.Type)
+	}
+}
+
+func TestBackplaneResumesOnAnotherHub(t *testing.T) {
+	backplane := NewLocalBackplane()
+	first, second := newTestHub(backplane), newTestHub(backplane)
+	a, b := connect(first, "", nil), connect(second, "", nil)
+
+	for _, messageType := range []string{"one", "two", "three"} {
+		first.Broadcast(models.WebsocketMessage{Type: messageType}, nil)
+	}
+	seen := receive(t, a)
+	for i := 0; i < 3; i++ {
+		receive(t, b)
+	}
+
+	// a drops after the first event and resumes on the other hub
+	c := connect(second, "", &seen.Id)
+	for _, want := range []string{"two", "three"} {
+		if got := receive(t, c); got.Type != want {
+			t.Errorf("replayed %q, want %q", got.Type, want)
+		}
+	}
+}
+
+func TestBackplaneSendsToUserOnAnotherHub(t *testing.T) {
+	backplane := NewLocalBackplane()
+	first, second := newTestHub(backplane), newTestHub(backplane)
+	alice, bob := connect(second, "alice", nil), connect(second, "bob", nil)
+
+	first.SendToUser("alice", models.WebsocketMessage{Type: "private"})
+	first.SendToUser("bob", models.WebsocketMessage{Type: "next"})
+
+	if got := receive(t, alice); got.Type != "private" {
+		t.Errorf("alice got %q, want private", got.Type)
+	}
+	if got := receive(t, bob); got.Type != "next" {
+		t.Errorf("bob got %q, want next", got.Type)
+	}
+}
+
+func TestBackplaneExcludesRecipients(t *testing.T) {
+	backplane := NewLocalBackplane()
+	first := newTestHub(backplane)
+	second := NewHub()
+	second.ExcludeRecipients(func(ctx context.Context, senderIds []string) ([]string, error) {
+		if len(senderIds) == 1 && senderIds[0] == "alice" {
+			return []string{"bob"}, nil
+		}
+		return nil, nil
+	})
+	second.UseBackplane(backplane)
+	go second.Run()
+	bob, carol := connect(second, "bob", nil), connect(second, "carol", nil)
+
+	first.BroadcastFrom(models.WebsocketMessage{Type: "from alice"}, []string{"alice"})
+	first.Broadcast(models.WebsocketMessage{Type: "next"}, nil)
+
+	if got := receive(t, bob); got.Type != "next" {
+		t.Errorf("bob got %q, want next", got.Type)
+	}
+	if got := receive(t, carol); got.Type != "from alice" {
+		t.Errorf("carol got %q, want from alice", got.Type)
+	}
+}
+
+func TestGapStopsReplays(t *testing.T) {
+	hub := newTestHub(NewLocalBackplane())
+	a := connect(hub, "", nil)
+
+	hub.Broadcast(models.WebsocketMessage{Type: "before"}, nil)
+	seen := receive(t, a)
+	hub.onBackplaneGap()
+	if got := receive(t, a); got.Type != models.STREAM_GAP {
+		t.Fatalf("got %q, want %s", got.Type, models.STREAM_GAP)
+	}
+
+	hub.Broadcast(models.WebsocketMessage{Type: "after"}, nil)
+	receive(t, a)
+	lastEventId := seen.Id - 1
+	b := connect(hub, "", &lastEventId)
+	if got := receive(t, b); got.Type != models.STREAM_GAP {
+		t.Errorf("resumed with %q, want %s", got.Type, models.STREAM_GAP)
+	}
+}
+
+func TestLocalBackplaneDoesNotWaitForSubscribers(t *testing.T) {
+	backplane := NewLocalBackplane()
+	stalled := make(chan struct{})
+	defer close(stalled)
+	backplane.Subscribe(func(id uint64, payload []byte) {
+		<-stalled
+	}, func() {})
+	received := make(chan uint64, 2*EVENT_LOG_SIZE)
+	backplane.Subscribe(func(id uint64, payload []byte) {
+		received <- id
+	}, func() {})
+
+	published := make(chan struct{})
+	go func() {
+		for i := 0; i < 2*EVENT_LOG_SIZE; i++ {
+			backplane.Publish([]byte("{}"), true)
+		}
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(receiveTimeout):
+		t.Fatal("publishing waited for the stalled subscriber")
+	}
+
+	for want := uint64(1); want <= 2*EVENT_LOG_SIZE; want++ {
+		select {
+		case id := <-received:
+			if id != want {
+				t.Fatalf("got id %d, want %d", id, want)
+			}
+		case <-time.After(receiveTimeout):
+			t.Fatalf("payload %d was not received", want)
+		}
+	}
+}
@@ -1,30 +1,97 @@
 package websockets
 
-import "github.com/gorilla/websocket"
+import (
+	"log"
 
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// large enough to queue a full replay without blocking the hub
+	OUTBOUND_BUFFER_SIZE = EVENT_LOG_SIZE + 1
+)
+
+// Client is a subscriber of the hub. Events queued on outbound are written
+// by the transport that owns the client, a websocket or an event stream.
 type Client struct {
-	hub      *Hub
-	id       string
-	socket   *websocket.Conn
-	outbound chan []byte
+	hub         *Hub
+	id          string
+	remoteAddr  string
+	format      string
+	userId      string
+	socket      *websocket.Conn
+	outbound    chan event
+	lastEventId *uint64
+	closed      bool
+	// guarded by the hub lock
+	topics  map[string]bool
+	signals map[string]*activeSignal
+	limiter *rateLimiter
 }
 
 func NewClient(hub *Hub, socket *websocket.Conn) *Client {
+	client := newClient(hub, socket.RemoteAddr().String())
+	client.socket = socket
+	client.format = socket.Subprotocol()
+	return client
+}
+
+func newClient(hub *Hub, remoteAddr string) *Client {
 	return &Client{
-		hub:      hub,
-		socket:   socket,
-		outbound: make(chan []byte),
+		hub:        hub,
+		id:         ksuid.New().String(),
+		remoteAddr: remoteAddr,
+		outbound:   make(chan event, OUTBOUND_BUFFER_SIZE),
+		topics:     make(map[string]bool),
+		signals:    make(map[string]*activeSignal),
+		limiter:    newRateLimiter(SIGNAL_RATE, SIGNAL_BURST),
 	}
 }
 
 func (c *Client) Write() {
 	for {
 		select {
-		case message, ok := <-c.outbound:
+		case e, ok := <-c.outbound:
 			if !ok {
 				c.socket.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			prepared, err := e.message.preparedFor(c.format)
+			if err != nil {
+				log.Println(err)
+				continue
+			}
+			c.socket.WritePreparedMessage(prepared)
+		}
+	}
+}
+
+// UserId is the authenticated user behind the connection, empty for
+// anonymous clients.
+func (c *Client) UserId() string {
+	return c.userId
+}
+
+// Read serves the request frames sent by the client until the socket fails,
+// then unregisters the client.
+func (c *Client) Read() {
+	defer func() {
+		c.hub.unregister <- c
+	}()
+	for {
+		messageType, data, err := c.socket.ReadMessage()
+		if err != nil {
+			return
+		}
+		if messageType == websocket.BinaryMessage && c.format == FORMAT_MSGPACK {
+			if data, err = msgpackToJson(data); err != nil {
+				log.Println(err)
+				continue
 			}
-			c.socket.WriteMessage(websocket.TextMessage, message)
+		} else if messageType != websocket.TextMessage {
+			continue
 		}
+		c.hub.dispatchFrame(c, data)
 	}
 }
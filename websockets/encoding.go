@@ -0,0 +1,104 @@
+package websockets
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// subprotocols a client may pick when upgrading; without one it gets JSON
+const (
+	FORMAT_JSON    = "v1.json"
+	FORMAT_MSGPACK = "v1.msgpack"
+)
+
+var formats = []string{FORMAT_JSON, FORMAT_MSGPACK}
+
+// encodedMessage holds a message in every wire format it was requested in.
+// Each format is encoded, and compressed when negotiated, once per message
+// no matter how many clients receive it.
+type encodedMessage struct {
+	json     []byte
+	lock     *sync.Mutex
+	prepared map[string]*websocket.PreparedMessage
+}
+
+func newEncodedMessage(data []byte) *encodedMessage {
+	return &encodedMessage{
+		json:     data,
+		lock:     &sync.Mutex{},
+		prepared: make(map[string]*websocket.PreparedMessage),
+	}
+}
+
+func (m *encodedMessage) preparedFor(format string) (*websocket.PreparedMessage, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if prepared, ok := m.prepared[format]; ok {
+		return prepared, nil
+	}
+
+	var prepared *websocket.PreparedMessage
+	var err error
+	switch format {
+	case FORMAT_MSGPACK:
+		var data []byte
+		data, err = jsonToMsgpack(m.json)
+		if err != nil {
+			return nil, err
+		}
+		prepared, err = websocket.NewPreparedMessage(websocket.BinaryMessage, data)
+	default:
+		prepared, err = websocket.NewPreparedMessage(websocket.TextMessage, m.json)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.prepared[format] = prepared
+	return prepared, nil
+}
+
+// jsonToMsgpack re-encodes a JSON document so both formats carry exactly the
+// same field names and shapes.
+func jsonToMsgpack(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return msgpack.Marshal(normalizeNumbers(value))
+}
+
+func msgpackToJson(data []byte) ([]byte, error) {
+	var value interface{}
+	if err := msgpack.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+func normalizeNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := v.Float64(); err == nil {
+			return u
+		}
+		return v.String()
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeNumbers(item)
+		}
+	}
+	return value
+}
@@ -0,0 +1,52 @@
+package websockets
+
+import "testing"
+
+func TestMsgpackRoundTrip(t *testing.T) {
+	// keys sorted and no spaces, as json.Marshal writes them
+	for _, message := range []string{
+		`{"id":42,"payload":{"content":"héllo 👋","tags":["go","ws"]},"type":"POST_CREATED"}`,
+		`{"big":9007199254740993,"float":1.5,"negative":-7,"zero":0}`,
+		`{"empty":{},"list":[],"no":false,"nothing":null,"yes":true}`,
+		`[1,"two",[3]]`,
+		`"text"`,
+	} {
+		packed, err := jsonToMsgpack([]byte(message))
+		if err != nil {
+			t.Fatalf("jsonToMsgpack(%s): %v", message, err)
+		}
+		unpacked, err := msgpackToJson(packed)
+		if err != nil {
+			t.Fatalf("msgpackToJson of %s: %v", message, err)
+		}
+		if string(unpacked) != message {
+			t.Errorf("got %s back, want %s", unpacked, message)
+		}
+	}
+}
+
+func TestJsonToMsgpackRejectsInvalidJSON(t *testing.T) {
+	if _, err := jsonToMsgpack([]byte(`{"type":`)); err == nil {
+		t.Error("invalid JSON was encoded")
+	}
+}
+
+func TestPreparedMessageIsEncodedOnce(t *testing.T) {
+	message := newEncodedMessage([]byte(`{"type":"test"}`))
+	for _, format := range formats {
+		first, err := message.preparedFor(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := message.preparedFor(format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first != second {
+			t.Errorf("%s was encoded twice", format)
+		}
+	}
+	if message.prepared[FORMAT_JSON] == message.prepared[FORMAT_MSGPACK] {
+		t.Error("both formats share an encoding")
+	}
+}
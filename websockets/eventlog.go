@@ -0,0 +1,118 @@
+package websockets
+
+const (
+	EVENT_LOG_SIZE = 1024
+)
+
+// audience narrows down which clients receive a message. The zero value
+// reaches everyone. Ephemeral messages skip the event log and are never
+// replayed.
+type audience struct {
+	UserId string `json:"user_id,omitempty"`
+	// restricts the event to these users when UserId is not set
+	UserIds []string `json:"user_ids,omitempty"`
+	// users left out whatever the rest of the audience
+	ExceptUserIds []string `json:"except_user_ids,omitempty"`
+	// the users the message comes from; whoever the hub's ExclusionFunc
+	// returns for them is added to ExceptUserIds on delivery
+	SenderIds []string `json:"sender_ids,omitempty"`
+	Topic     string   `json:"topic,omitempty"`
+	// the connection that sent the message, which already knows about it
+	ExceptClientId string `json:"except_client_id,omitempty"`
+	Ephemeral      bool   `json:"ephemeral,omitempty"`
+}
+
+// includes must be called with the hub lock held.
+func (a audience) includes(client *Client) bool {
+	if a.UserId != "" && a.UserId != client.userId {
+		return false
+	}
+	if a.UserIds != nil && !containsUser(a.UserIds, client.userId) {
+		return false
+	}
+	if containsUser(a.ExceptUserIds, client.userId) {
+		return false
+	}
+	if a.Topic != "" && !client.topics[a.Topic] {
+		return false
+	}
+	if a.ExceptClientId != "" && a.ExceptClientId == client.id {
+		return false
+	}
+	return true
+}
+
+// event is an encoded hub message together with its sequence id. Signals
+// that are not part of the stream, such as a gap notice, have id 0.
+type event struct {
+	id uint64
+	// the type of the message
+	kind     string
+	message  *encodedMessage
+	audience audience
+}
+
+// eventLog keeps the most recent events in a ring buffer so reconnecting
+// clients can catch up on what they missed. Events are appended in the
+// order of their ids, which the backplane issues.
+type eventLog struct {
+	events []event
+	start  int
+	count  int
+	lastId uint64
+}
+
+func newEventLog(size int) *eventLog {
+	return &eventLog{
+		events: make([]event, size),
+	}
+}
+
+func (l *eventLog) append(e event) {
+	l.lastId = e.id
+	end := (l.start + l.count) % len(l.events)
+	l.events[end] = e
+	if l.count < len(l.events) {
+		l.count++
+		return
+	}
+	l.start = (l.start + 1) % len(l.events)
+}
+
+// reset forgets the logged events but not the last id.
+func (l *eventLog) reset() {
+	l.events = make([]event, len(l.events))
+	l.start = 0
+	l.count = 0
+}
+
+// since returns the events after lastId in order. ok is false when events
+// after lastId have already been evicted, or lastId was never issued by this
+// log (e.g. after a restart), and the client must refetch.
+func (l *eventLog) since(lastId uint64) (events []event, ok bool) {
+	if lastId == l.lastId {
+		return nil, true
+	}
+	if lastId > l.lastId || l.count == 0 || lastId+1 < l.events[l.start].id {
+		return nil, false
+	}
+	for i := 0; i < l.count; i++ {
+		event := l.events[(l.start+i)%len(l.events)]
+		if event.id > lastId {
+			events = append(events, event)
+		}
+	}
+	return events, true
+}
+
+func containsUser(userIds []string, userId string) bool {
+	if userId == "" {
+		return false
+	}
+	for _, id := range userIds {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,161 @@
+package websockets
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// newFilledLog logs the events numbered first to last in a log of size.
+func newFilledLog(size int, first, last uint64) *eventLog {
+	log := newEventLog(size)
+	for id := first; id <= last; id++ {
+		log.append(event{id: id})
+	}
+	return log
+}
+
+func ids(events []event) []uint64 {
+	ids := make([]uint64, 0, len(events))
+	for _, e := range events {
+		ids = append(ids, e.id)
+	}
+	return ids
+}
+
+func TestEventLogSince(t *testing.T) {
+	for name, test := range map[string]struct {
+		log    *eventLog
+		lastId uint64
+		want   []uint64
+		ok     bool
+	}{
+		"not full":                 {newFilledLog(4, 1, 3), 1, []uint64{2, 3}, true},
+		"from the start":           {newFilledLog(4, 1, 3), 0, []uint64{1, 2, 3}, true},
+		"up to date":               {newFilledLog(4, 1, 3), 3, []uint64{}, true},
+		"across the wrap":          {newFilledLog(4, 1, 10), 8, []uint64{9, 10}, true},
+		"wrapped twice":            {newFilledLog(3, 1, 8), 6, []uint64{7, 8}, true},
+		"right before the oldest":  {newFilledLog(4, 1, 10), 6, []uint64{7, 8, 9, 10}, true},
+		"evicted":                  {newFilledLog(4, 1, 10), 5, nil, false},
+		"long evicted":             {newFilledLog(4, 1, 10), 0, nil, false},
+		"never issued":             {newFilledLog(4, 1, 10), 11, nil, false},
+		"empty log":                {newEventLog(4), 3, nil, false},
+		"ids not starting at one":  {newFilledLog(4, 100, 102), 99, []uint64{100, 101, 102}, true},
+		"before ids starting late": {newFilledLog(4, 100, 102), 50, nil, false},
+	} {
+		events, ok := test.log.since(test.lastId)
+		if ok != test.ok {
+			t.Errorf("%s: ok %v, want %v", name, ok, test.ok)
+			continue
+		}
+		if got := ids(events); ok && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %v, want %v", name, got, test.want)
+		}
+	}
+}
+
+func TestEventLogReset(t *testing.T) {
+	log := newFilledLog(4, 1, 3)
+	log.reset()
+	if _, ok := log.since(2); ok {
+		t.Error("events from before the reset were replayed")
+	}
+	if log.lastId != 3 {
+		t.Errorf("last id %d, want 3", log.lastId)
+	}
+	log.append(event{id: 4})
+	if events, ok := log.since(3); !ok || !reflect.DeepEqual(ids(events), []uint64{4}) {
+		t.Errorf("got %v, %v after the reset", ids(events), ok)
+	}
+}
+
+func TestAudienceIncludes(t *testing.T) {
+	alice := newClient(nil, "test")
+	alice.userId = "alice"
+	alice.topics["conversation:1"] = true
+	anonymous := newClient(nil, "test")
+
+	for name, test := range map[string]struct {
+		audience  audience
+		alice     bool
+		anonymous bool
+	}{
+		"everyone":         {audience{}, true, true},
+		"user":             {audience{UserId: "alice"}, true, false},
+		"other user":       {audience{UserId: "bob"}, false, false},
+		"users":            {audience{UserIds: []string{"bob", "alice"}}, true, false},
+		"no users":         {audience{UserIds: []string{}}, false, false},
+		"except user":      {audience{ExceptUserIds: []string{"alice"}}, false, true},
+		"topic":            {audience{Topic: "conversation:1"}, true, false},
+		"other topic":      {audience{Topic: "conversation:2"}, false, false},
+		"except client":    {audience{ExceptClientId: alice.id}, false, true},
+		"user and topic":   {audience{UserIds: []string{"alice"}, Topic: "conversation:2"}, false, false},
+		"senders are kept": {audience{SenderIds: []string{"alice"}}, true, true},
+	} {
+		if got := test.audience.includes(alice); got != test.alice {
+			t.Errorf("%s: includes alice %v, want %v", name, got, test.alice)
+		}
+		if got := test.audience.includes(anonymous); got != test.anonymous {
+			t.Errorf("%s: includes anonymous %v, want %v", name, got, test.anonymous)
+		}
+	}
+}
+
+func TestReplayFiltersAudience(t *testing.T) {
+	hub := newTestHub(NewLocalBackplane())
+	bob := connect(hub, "bob", nil)
+
+	hub.Broadcast(models.WebsocketMessage{Type: "first"}, nil)
+	seen := receive(t, bob)
+	hub.SendToUser("alice", models.WebsocketMessage{Type: "for alice"})
+	hub.SendToUser("bob", models.WebsocketMessage{Type: "for bob"})
+	hub.Broadcast(models.WebsocketMessage{Type: "last"}, nil)
+	receive(t, bob)
+	receive(t, bob)
+
+	resumed := connect(hub, "bob", &seen.Id)
+	for _, want := range []string{"for bob", "last"} {
+		if got := receive(t, resumed); got.Type != want {
+			t.Errorf("replayed %q, want %q", got.Type, want)
+		}
+	}
+}
+
+func TestReplayReportsEvictedEvents(t *testing.T) {
+	hub := NewHub()
+	hub.events = newEventLog(2)
+	go hub.Run()
+	a := connect(hub, "", nil)
+
+	var first models.WebsocketMessage
+	for i, messageType := range []string{"one", "two", "three"} {
+		hub.Broadcast(models.WebsocketMessage{Type: messageType}, nil)
+		if message := receive(t, a); i == 0 {
+			first = message
+		}
+	}
+
+	lastEventId := first.Id - 1
+	b := connect(hub, "", &lastEventId)
+	got := receive(t, b)
+	if got.Type != models.STREAM_GAP {
+		t.Fatalf("got %q, want %s", got.Type, models.STREAM_GAP)
+	}
+	data, _ := json.Marshal(got.Payload)
+	var gap models.StreamGapPayload
+	json.Unmarshal(data, &gap)
+	if gap.LastEventId != lastEventId || gap.NextEventId != first.Id+3 {
+		t.Errorf("gap %+v, want from %d to %d", gap, lastEventId, first.Id+3)
+	}
+
+	// the oldest event still logged is right after this one
+	lastEventId = first.Id
+	c := connect(hub, "", &lastEventId)
+	for _, want := range []string{"two", "three"} {
+		if got := receive(t, c); got.Type != want {
+			t.Errorf("replayed %q, want %q", got.Type, want)
+		}
+	}
+}
@@ -1,93 +1,391 @@
 package websockets
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
+	"github.com/adrisongomez/project-go/models"
+	"github.com/adrisongomez/project-go/utils"
 	"github.com/gorilla/websocket"
+	"github.com/segmentio/ksuid"
 )
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	EnableCompression: true,
+	Subprotocols:      formats,
+}
+
+type backplaneEnvelope struct {
+	Audience audience                `json:"audience"`
+	Message  models.WebsocketMessage `json:"message"`
 }
 
 type Hub struct {
+	id         string
 	clients    []*Client
 	register   chan *Client
 	unregister chan *Client
-	lock       *sync.Mutex
+	inbound    chan backplaneEnvelope
+	gaps       chan struct{}
+	backplane  Backplane
+	events     *eventLog
+	presence   *presence
+	// frame handlers are registered before the hub runs and only read after
+	frameHandlers    map[string]FrameHandler
+	authorizeTopic   TopicAuthorizer
+	exclude          ExclusionFunc
+	deliveryHandlers map[string]DeliveryFunc
+	// how long a signal stays active unless refreshed
+	signalTTL time.Duration
+	lock      *sync.Mutex
 }
 
 func NewHub() *Hub {
-	return &Hub{
-		clients:    make([]*Client, 0),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		lock:       &sync.Mutex{},
+	hub := &Hub{
+		id:               ksuid.New().String(),
+		clients:          make([]*Client, 0),
+		register:         make(chan *Client),
+		unregister:       make(chan *Client),
+		inbound:          make(chan backplaneEnvelope),
+		gaps:             make(chan struct{}),
+		events:           newEventLog(EVENT_LOG_SIZE),
+		presence:         newPresence(),
+		frameHandlers:    make(map[string]FrameHandler),
+		deliveryHandlers: make(map[string]DeliveryFunc),
+		signalTTL:        SIGNAL_TTL,
+		lock:             &sync.Mutex{},
+	}
+	hub.bindSignalFrames()
+	// on its own, the hub relays its messages to itself
+	hub.UseBackplane(NewLocalBackplane())
+	return hub
+}
+
+// UseBackplane connects the hub to other instances, replacing the backplane
+// it used before. Messages sent here are published to the backplane and only
+// delivered to the local clients once they come back from it, numbered the
+// same on every instance.
+func (hub *Hub) UseBackplane(backplane Backplane) {
+	if hub.backplane != nil {
+		hub.backplane.Close()
 	}
+	hub.backplane = backplane
+	backplane.Subscribe(hub.onBackplaneMessage, hub.onBackplaneGap)
 }
 
+// HandleWebSocket upgrades the connection. Clients resuming a dropped
+// connection pass the id of the last event they saw as last_event_id and
+// receive the missed events before live ones. Connections made through the
+// authenticated route are attached to the user for presence tracking.
 func (hub *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	lastEventId, err := parseLastEventId(r.URL.Query().Get("last_event_id"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	socket, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Cloud not open websocket connection", http.StatusInternalServerError)
+		return
 	}
 	client := NewClient(hub, socket)
+	client.userId = userIdFromRequest(r)
+	client.lastEventId = lastEventId
 
 	hub.register <- client
 
 	go client.Write()
+	go client.Read()
+}
+
+func userIdFromRequest(r *http.Request) string {
+	if user, ok := r.Context().Value(utils.USER_KEY).(*models.User); ok {
+		return user.Id
+	}
+	return ""
+}
+
+func parseLastEventId(value string) (*uint64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
 }
 
 func (hub *Hub) Run() {
+	go hub.runPresence()
 	for {
 		select {
 		case client := <-hub.register:
 			hub.onConnect(client)
 		case client := <-hub.unregister:
 			hub.onDisconnect(client)
-
+		case envelope := <-hub.inbound:
+			hub.deliver(envelope.Message, envelope.Audience)
+		case <-hub.gaps:
+			hub.onGap()
 		}
 	}
 }
 
 func (hub *Hub) onConnect(client *Client) {
-	log.Println("Client connected", client.socket.RemoteAddr())
+	log.Println("Client connected", client.remoteAddr)
 	hub.lock.Lock()
-	defer hub.lock.Unlock()
-	client.id = client.socket.RemoteAddr().String()
+	if client.lastEventId != nil {
+		hub.replay(client, *client.lastEventId)
+	}
 	hub.clients = append(hub.clients, client)
+	hub.lock.Unlock()
+
+	// outside the lock, as the presence goroutine may be waiting for the hub
+	if client.userId != "" {
+		hub.presence.changes <- presenceChange{userId: client.userId, connected: true}
+	}
+}
+
+// replay queues the events the client missed. It must be called with the
+// lock held so no live event can slip in between.
+func (hub *Hub) replay(client *Client, lastEventId uint64) {
+	events, ok := hub.events.since(lastEventId)
+	if !ok {
+		data, _ := json.Marshal(models.WebsocketMessage{
+			Type: models.STREAM_GAP,
+			Payload: models.StreamGapPayload{
+				LastEventId: lastEventId,
+				NextEventId: hub.events.lastId + 1,
+			},
+		})
+		client.outbound <- event{message: newEncodedMessage(data)}
+		return
+	}
+	for _, event := range events {
+		if event.audience.includes(client) {
+			client.outbound <- event
+			if event.audience.UserId != "" {
+				hub.handedOff(event)
+			}
+		}
+	}
 }
 
 func (hub *Hub) onDisconnect(client *Client) {
-	log.Println("Client disconnected", client.socket.RemoteAddr().String())
-	client.socket.Close()
+	log.Println("Client disconnected", client.remoteAddr)
+	if client.socket != nil {
+		client.socket.Close()
+	}
 	hub.lock.Lock()
-	defer hub.lock.Unlock()
 	i := -1
 	for j, c := range hub.clients {
 		if c.id == client.id {
 			i = j
 		}
 	}
+	if i == -1 {
+		hub.lock.Unlock()
+		return
+	}
 
+	client.closed = true
+	close(client.outbound)
 	copy(hub.clients[i:], hub.clients[i+1:])
 	hub.clients[len(hub.clients)-1] = nil
 	hub.clients = hub.clients[:len(hub.clients)-1]
+	expired := hub.takeSignals(client, "")
+	hub.lock.Unlock()
+
+	if client.userId != "" {
+		hub.presence.changes <- presenceChange{userId: client.userId}
+	}
+	if len(expired) > 0 {
+		go hub.expireSignals(client, expired)
+	}
 }
 
-func (hub *Hub) Broadcast(message interface{}, ignore *Client) {
-	data, _ := json.Marshal(message)
+func (hub *Hub) onBackplaneMessage(id uint64, payload []byte) {
+	var envelope backplaneEnvelope
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		log.Println("backplane:", err)
+		return
+	}
+	envelope.Message.Id = id
+	if len(envelope.Audience.SenderIds) > 0 && hub.exclude != nil {
+		excluded, err := hub.exclude(context.Background(), envelope.Audience.SenderIds)
+		if err != nil {
+			// better missed than shown to someone who blocked the sender
+			log.Println("backplane:", err)
+			return
+		}
+		envelope.Audience.ExceptUserIds = append(envelope.Audience.ExceptUserIds, excluded...)
+	}
+	hub.inbound <- envelope
+}
+
+// ExclusionFunc returns the users who must not receive what any of senderIds
+// sends, such as the users blocking them.
+type ExclusionFunc func(ctx context.Context, senderIds []string) ([]string, error)
+
+// ExcludeRecipients sets how the recipients left out of the messages sent on
+// behalf of users are found. Each instance looks them up as it receives a
+// message, so they never travel through the backplane. It must be called
+// before the hub runs.
+func (hub *Hub) ExcludeRecipients(exclude ExclusionFunc) {
+	hub.exclude = exclude
+}
+
+// onBackplaneGap goes through Run like the messages, so the gap is handled
+// between the events before and after it.
+func (hub *Hub) onBackplaneGap() {
+	hub.gaps <- struct{}{}
+}
 
+// onGap tells the clients that events were lost and forgets the logged ones,
+// so nobody resumes across the gap.
+func (hub *Hub) onGap() {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	data, _ := json.Marshal(models.WebsocketMessage{
+		Type: models.STREAM_GAP,
+		Payload: models.StreamGapPayload{
+			LastEventId: hub.events.lastId,
+			NextEventId: hub.events.lastId + 1,
+		},
+	})
+	hub.events.reset()
+	e := event{message: newEncodedMessage(data)}
 	for _, client := range hub.clients {
-		if client == ignore {
-			continue
+		hub.queue(client, e)
+	}
+}
+
+// Broadcast sends message to every client connected to this hub except
+// ignore, and to every client of the other hubs sharing the backplane.
+// The backplane numbers the message, so its event id is the same on every
+// instance.
+func (hub *Hub) Broadcast(message models.WebsocketMessage, ignore *Client) {
+	hub.send(message, ignore, audience{})
+}
+
+// BroadcastFrom sends message to every client of every hub on behalf of
+// senderIds, leaving out the users the ExclusionFunc returns for them.
+func (hub *Hub) BroadcastFrom(message models.WebsocketMessage, senderIds []string) {
+	hub.send(message, nil, audience{SenderIds: senderIds})
+}
+
+// SendToUser delivers message only to the connections of userId, on this
+// and every other instance.
+func (hub *Hub) SendToUser(userId string, message models.WebsocketMessage) {
+	hub.send(message, nil, audience{UserId: userId})
+}
+
+// SendToUsers delivers message only to the connections of the given users,
+// on this and every other instance. Nobody receives it when userIds is
+// empty.
+func (hub *Hub) SendToUsers(userIds []string, message models.WebsocketMessage) {
+	if len(userIds) == 0 {
+		return
+	}
+	hub.send(message, nil, audience{UserIds: userIds})
+}
+
+// SendToUsersFrom is SendToUsers on behalf of senderIds, leaving out the
+// users the ExclusionFunc returns for them.
+func (hub *Hub) SendToUsersFrom(userIds []string, senderIds []string, message models.WebsocketMessage) {
+	if len(userIds) == 0 {
+		return
+	}
+	hub.send(message, nil, audience{UserIds: userIds, SenderIds: senderIds})
+}
+
+// send publishes message to the backplane; this hub delivers it along with
+// the others once it comes back.
+func (hub *Hub) send(message models.WebsocketMessage, ignore *Client, to audience) {
+	if ignore != nil {
+		to.ExceptClientId = ignore.id
+	}
+	payload, _ := json.Marshal(backplaneEnvelope{
+		Audience: to,
+		Message:  message,
+	})
+	if err := hub.backplane.Publish(payload, !to.Ephemeral); err != nil {
+		log.Println("backplane:", err)
+	}
+}
+
+// deliver queues message, numbered by the backplane, for the local clients
+// in its audience.
+func (hub *Hub) deliver(message models.WebsocketMessage, to audience) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	data, _ := json.Marshal(message)
+	e := event{id: message.Id, kind: message.Type, message: newEncodedMessage(data), audience: to}
+	if !to.Ephemeral {
+		hub.events.append(e)
+	}
+	queued := false
+	for _, client := range hub.clients {
+		if to.includes(client) && hub.queue(client, e) {
+			queued = true
 		}
-		client.outbound <- data
 	}
+	if queued && to.UserId != "" {
+		hub.handedOff(e)
+	}
+}
+
+// queue must be called with the lock held. It returns false when the client
+// could not take e.
+func (hub *Hub) queue(client *Client, e event) bool {
+	select {
+	case client.outbound <- e:
+		return true
+	default:
+		// a client that cannot keep up is dropped; it can resume from its
+		// last event id once it reconnects
+		go func() {
+			hub.unregister <- client
+		}()
+		return false
+	}
+}
+
+// DeliveryFunc is called once a message sent to userId was handed to one of
+// their connections, with the payload of the message.
+type DeliveryFunc func(userId string, payload json.RawMessage)
+
+// OnDelivered registers the function called when a message of the given
+// type, sent to a single user, is handed to one of their connections on
+// this instance. It may be called more than once for the same message, by
+// several instances or on replays. It must be called before the hub runs.
+func (hub *Hub) OnDelivered(messageType string, onDelivered DeliveryFunc) {
+	hub.deliveryHandlers[messageType] = onDelivered
+}
+
+// handedOff must be called with the lock held.
+func (hub *Hub) handedOff(e event) {
+	onDelivered, ok := hub.deliveryHandlers[e.kind]
+	if !ok {
+		return
+	}
+	var message struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(e.message.json, &message); err != nil {
+		log.Println(err)
+		return
+	}
+	go onDelivered(e.audience.UserId, message.Payload)
 }
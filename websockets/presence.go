@@ -0,0 +1,250 @@
+package websockets
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+const (
+	// how long a user may be without connections before going offline, so
+	// reloading a tab does not flap their presence
+	PRESENCE_DEBOUNCE = 5 * time.Second
+	// how often a hub tells the presence store it is still alive
+	PRESENCE_HEARTBEAT = 15 * time.Second
+	// connections and disconnections queued before the hub waits for the
+	// presence store
+	PRESENCE_QUEUE = 256
+)
+
+// PresenceStore counts the connections of each user on every instance, so
+// a user goes online with their first connection to any of them and offline
+// once they closed the last one.
+type PresenceStore interface {
+	// Connect records a connection of userId to the hub. first is true when
+	// the user was not listed on any instance, not even as just disconnected.
+	Connect(hubId string, userId string) (first bool, err error)
+	// Disconnect removes a connection. The user stays listed, with no
+	// connections on the hub, until Forget.
+	Disconnect(hubId string, userId string) error
+	// Forget unlists a user who has no connections left on the hub. gone is
+	// true when they are not listed on any other instance either.
+	Forget(hubId string, userId string) (gone bool, err error)
+	// Expire keeps the entries of the hub alive and drops the ones of the
+	// instances that stopped doing so. It returns the users no longer listed
+	// anywhere because of it.
+	Expire(hubId string) ([]string, error)
+	// Online lists the users listed on any instance.
+	Online() ([]models.OnlineUser, error)
+}
+
+type presenceChange struct {
+	userId    string
+	connected bool
+}
+
+type presenceExpiry struct {
+	userId string
+	timer  *time.Timer
+}
+
+// presence is only touched by the presence goroutine of the hub, which
+// applies the changes in order without holding up the hub.
+type presence struct {
+	store       PresenceStore
+	changes     chan presenceChange
+	expired     chan presenceExpiry
+	connections map[string]int
+	offline     map[string]*time.Timer
+}
+
+func newPresence() *presence {
+	return &presence{
+		store:       NewLocalPresence(),
+		changes:     make(chan presenceChange, PRESENCE_QUEUE),
+		expired:     make(chan presenceExpiry),
+		connections: make(map[string]int),
+		offline:     make(map[string]*time.Timer),
+	}
+}
+
+// UsePresenceStore shares the presence of the users with other instances. It
+// must be called before the hub runs.
+func (hub *Hub) UsePresenceStore(store PresenceStore) {
+	hub.presence.store = store
+}
+
+func (hub *Hub) runPresence() {
+	heartbeat := time.NewTicker(PRESENCE_HEARTBEAT)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case change := <-hub.presence.changes:
+			if change.connected {
+				hub.userConnected(change.userId)
+			} else {
+				hub.userDisconnected(change.userId)
+			}
+		case expiry := <-hub.presence.expired:
+			hub.userExpired(expiry)
+		case <-heartbeat.C:
+			users, err := hub.presence.store.Expire(hub.id)
+			if err != nil {
+				log.Println("presence:", err)
+			}
+			for _, userId := range users {
+				hub.broadcastPresence(models.PRESENCE_OFFLINE, userId)
+			}
+		}
+	}
+}
+
+func (hub *Hub) userConnected(userId string) {
+	first, err := hub.presence.store.Connect(hub.id, userId)
+	if err != nil {
+		log.Println("presence:", err)
+		return
+	}
+	hub.presence.connections[userId]++
+	if timer, ok := hub.presence.offline[userId]; ok {
+		// back before the debounce expired; nobody saw them leave
+		timer.Stop()
+		delete(hub.presence.offline, userId)
+		return
+	}
+	// still listed somewhere else, online already or about to be back
+	if !first {
+		return
+	}
+	hub.broadcastPresence(models.PRESENCE_ONLINE, userId)
+}
+
+func (hub *Hub) userDisconnected(userId string) {
+	if hub.presence.connections[userId] == 0 {
+		// the connection was never recorded
+		return
+	}
+	if err := hub.presence.store.Disconnect(hub.id, userId); err != nil {
+		log.Println("presence:", err)
+	}
+	hub.presence.connections[userId]--
+	if hub.presence.connections[userId] > 0 {
+		return
+	}
+	delete(hub.presence.connections, userId)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(PRESENCE_DEBOUNCE, func() {
+		hub.presence.expired <- presenceExpiry{userId: userId, timer: timer}
+	})
+	hub.presence.offline[userId] = timer
+}
+
+func (hub *Hub) userExpired(expiry presenceExpiry) {
+	// stopped too late, they came back in the meantime
+	if hub.presence.offline[expiry.userId] != expiry.timer {
+		return
+	}
+	delete(hub.presence.offline, expiry.userId)
+
+	gone, err := hub.presence.store.Forget(hub.id, expiry.userId)
+	if err != nil {
+		log.Println("presence:", err)
+		return
+	}
+	if gone {
+		hub.broadcastPresence(models.PRESENCE_OFFLINE, expiry.userId)
+	}
+}
+
+// broadcastPresence leaves out the users who must not see userId.
+func (hub *Hub) broadcastPresence(presenceType string, userId string) {
+	// a goroutine, as publishing may wait for the hub
+	go hub.send(models.WebsocketMessage{
+		Type:    presenceType,
+		Payload: models.PresencePayload{UserId: userId},
+	}, nil, audience{SenderIds: []string{userId}})
+}
+
+// OnlineUsers lists the users with at least one connection to any instance,
+// including the ones still within the offline debounce.
+func (hub *Hub) OnlineUsers() ([]models.OnlineUser, error) {
+	return hub.presence.store.Online()
+}
+
+// LocalPresence is an in-process PresenceStore, for a hub on its own or hubs
+// sharing it in tests. Its entries never expire.
+type LocalPresence struct {
+	// connections by user, then by hub
+	connections map[string]map[string]int
+	lock        *sync.Mutex
+}
+
+func NewLocalPresence() *LocalPresence {
+	return &LocalPresence{
+		connections: make(map[string]map[string]int),
+		lock:        &sync.Mutex{},
+	}
+}
+
+func (p *LocalPresence) Connect(hubId string, userId string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	hubs, ok := p.connections[userId]
+	if !ok {
+		hubs = make(map[string]int)
+		p.connections[userId] = hubs
+	}
+	hubs[hubId]++
+	return !ok, nil
+}
+
+func (p *LocalPresence) Disconnect(hubId string, userId string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if hubs, ok := p.connections[userId]; ok && hubs[hubId] > 0 {
+		hubs[hubId]--
+	}
+	return nil
+}
+
+func (p *LocalPresence) Forget(hubId string, userId string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	hubs, ok := p.connections[userId]
+	if !ok {
+		return true, nil
+	}
+	if connections, ok := hubs[hubId]; ok && connections == 0 {
+		delete(hubs, hubId)
+	}
+	if len(hubs) > 0 {
+		return false, nil
+	}
+	delete(p.connections, userId)
+	return true, nil
+}
+
+func (p *LocalPresence) Expire(hubId string) ([]string, error) {
+	return nil, nil
+}
+
+func (p *LocalPresence) Online() ([]models.OnlineUser, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	users := make([]models.OnlineUser, 0, len(p.connections))
+	for userId, hubs := range p.connections {
+		user := models.OnlineUser{UserId: userId}
+		for _, connections := range hubs {
+			user.Connections += connections
+		}
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserId < users[j].UserId
+	})
+	return users, nil
+}
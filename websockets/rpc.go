@@ -0,0 +1,73 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+const (
+	FRAME_TIMEOUT = 10 * time.Second
+)
+
+// FrameHandler serves a request frame sent by client. The returned value is
+// sent back as the ack payload; a *models.RpcError keeps its status, any
+// other error is reported as an internal error.
+type FrameHandler func(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error)
+
+// HandleFrame registers the handler for frames of the given type. It must be
+// called before the hub starts accepting connections.
+func (hub *Hub) HandleFrame(frameType string, handler FrameHandler) {
+	hub.frameHandlers[frameType] = handler
+}
+
+func (hub *Hub) dispatchFrame(client *Client, data []byte) {
+	var request models.RpcRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		hub.reply(client, nil, &models.RpcError{Status: http.StatusBadRequest, Message: err.Error()}, nil)
+		return
+	}
+
+	handler, ok := hub.frameHandlers[request.Type]
+	if !ok {
+		hub.reply(client, request.Id, &models.RpcError{Status: http.StatusNotFound, Message: "unknown frame type " + request.Type}, nil)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), FRAME_TIMEOUT)
+	defer cancel()
+	result, err := handler(ctx, client, request.Payload)
+	hub.reply(client, request.Id, err, result)
+}
+
+func (hub *Hub) reply(client *Client, id json.RawMessage, err error, result interface{}) {
+	response := models.RpcResponse{
+		Id:      id,
+		Type:    models.RPC_ACK,
+		Payload: result,
+	}
+	if err != nil {
+		var rpcErr *models.RpcError
+		if !errors.As(err, &rpcErr) {
+			rpcErr = &models.RpcError{Status: http.StatusInternalServerError, Message: err.Error()}
+		}
+		response.Type = models.RPC_ERROR
+		response.Payload = rpcErr
+	}
+	data, _ := json.Marshal(response)
+	hub.sendTo(client, event{message: newEncodedMessage(data)})
+}
+
+// sendTo queues e for a single client unless it already disconnected.
+func (hub *Hub) sendTo(client *Client, e event) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	if client.closed {
+		return
+	}
+	hub.queue(client, e)
+}
@@ -0,0 +1,108 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+func newRpcHub() *Hub {
+	hub := NewHub()
+	hub.HandleFrame("echo", func(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+		return payload, nil
+	})
+	hub.HandleFrame("nothing", func(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+		return nil, nil
+	})
+	hub.HandleFrame("conflict", func(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+		return nil, fmt.Errorf("saving: %w", &models.RpcError{Status: http.StatusConflict, Message: "already there"})
+	})
+	hub.HandleFrame("crash", func(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+		return nil, errors.New("database is down")
+	})
+	hub.HandleFrame("deadline", func(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+		if _, ok := ctx.Deadline(); !ok {
+			return nil, errors.New("no deadline")
+		}
+		return "ok", nil
+	})
+	return hub
+}
+
+func TestDispatchFrame(t *testing.T) {
+	hub := newRpcHub()
+	for name, test := range map[string]struct {
+		frame string
+		want  string
+	}{
+		"ack": {
+			`{"id":7,"type":"echo","payload":{"text":"hi"}}`,
+			`{"id":7,"type":"ack","payload":{"text":"hi"}}`,
+		},
+		"string id": {
+			`{"id":"req-1","type":"echo","payload":[1,2]}`,
+			`{"id":"req-1","type":"ack","payload":[1,2]}`,
+		},
+		"no result": {
+			`{"id":1,"type":"nothing"}`,
+			`{"id":1,"type":"ack","payload":null}`,
+		},
+		"no id": {
+			`{"type":"nothing"}`,
+			`{"id":null,"type":"ack","payload":null}`,
+		},
+		"deadline": {
+			`{"id":2,"type":"deadline"}`,
+			`{"id":2,"type":"ack","payload":"ok"}`,
+		},
+		"unknown type": {
+			`{"id":3,"type":"launch"}`,
+			`{"id":3,"type":"error","payload":{"status":404,"message":"unknown frame type launch"}}`,
+		},
+		"wrapped rpc error": {
+			`{"id":4,"type":"conflict"}`,
+			`{"id":4,"type":"error","payload":{"status":409,"message":"already there"}}`,
+		},
+		"other error": {
+			`{"id":5,"type":"crash"}`,
+			`{"id":5,"type":"error","payload":{"status":500,"message":"database is down"}}`,
+		},
+		"malformed payload": {
+			`{"id":6,"type":"topic.subscribe","payload":"conversation:1"}`,
+			`{"id":6,"type":"error","payload":{"status":400,"message":"topic is required"}}`,
+		},
+		"malformed frame": {
+			`{"id":8,"type":`,
+			`{"id":null,"type":"error","payload":{"status":400,"message":"unexpected end of JSON input"}}`,
+		},
+	} {
+		client := newClient(hub, "test")
+		hub.dispatchFrame(client, []byte(test.frame))
+		select {
+		case e := <-client.outbound:
+			if string(e.message.json) != test.want {
+				t.Errorf("%s: got %s, want %s", name, e.message.json, test.want)
+			}
+			if e.id != 0 {
+				t.Errorf("%s: the reply has event id %d", name, e.id)
+			}
+		default:
+			t.Errorf("%s: no reply", name)
+		}
+	}
+}
+
+func TestReplyToDisconnectedClient(t *testing.T) {
+	hub := newRpcHub()
+	client := newClient(hub, "test")
+	client.closed = true
+	hub.dispatchFrame(client, []byte(`{"id":1,"type":"echo"}`))
+	if len(client.outbound) != 0 {
+		t.Error("a reply was queued for a disconnected client")
+	}
+}
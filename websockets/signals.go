@@ -0,0 +1,218 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+const (
+	// signals per second a client may send, with bursts up to SIGNAL_BURST
+	SIGNAL_RATE  = 5
+	SIGNAL_BURST = 10
+	SIGNAL_TTL   = 10 * time.Second
+
+	MAX_TOPICS_PER_CLIENT = 64
+	MAX_SIGNAL_DATA_SIZE  = 1024
+)
+
+var signalKinds = map[string]bool{
+	"typing": true,
+	"focus":  true,
+}
+
+type TopicFrame struct {
+	Topic string `json:"topic"`
+}
+
+// TopicAuthorizer tells whether userId, empty for anonymous clients, may
+// subscribe to topic.
+type TopicAuthorizer func(ctx context.Context, userId string, topic string) (bool, error)
+
+// AuthorizeTopics sets which topics clients may subscribe to; every
+// subscription is refused until it is called. It must be called before the
+// hub starts accepting connections.
+func (hub *Hub) AuthorizeTopics(authorize TopicAuthorizer) {
+	hub.authorizeTopic = authorize
+}
+
+// activeSignal is a signal a client started. Its timer stops it for the
+// other subscribers once it was not refreshed for the hub signalTTL.
+type activeSignal struct {
+	payload models.SignalPayload
+	timer   *time.Timer
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second.
+type rateLimiter struct {
+	tokens float64
+	rate   float64
+	burst  float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst float64) *rateLimiter {
+	return &rateLimiter{
+		tokens: burst,
+		rate:   rate,
+		burst:  burst,
+		last:   time.Now(),
+	}
+}
+
+func (l *rateLimiter) allow() bool {
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+	return true
+}
+
+func (hub *Hub) bindSignalFrames() {
+	hub.HandleFrame("topic.subscribe", hub.subscribeFrame)
+	hub.HandleFrame("topic.unsubscribe", hub.unsubscribeFrame)
+	hub.HandleFrame(models.SIGNAL, hub.signalFrame)
+}
+
+func (hub *Hub) subscribeFrame(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+	var request TopicFrame
+	if err := json.Unmarshal(payload, &request); err != nil || request.Topic == "" {
+		return nil, &models.RpcError{Status: http.StatusBadRequest, Message: "topic is required"}
+	}
+	if hub.authorizeTopic == nil {
+		return nil, &models.RpcError{Status: http.StatusForbidden, Message: "topic not allowed"}
+	}
+	allowed, err := hub.authorizeTopic(ctx, client.userId, request.Topic)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, &models.RpcError{Status: http.StatusForbidden, Message: "topic not allowed"}
+	}
+
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	if !client.topics[request.Topic] && len(client.topics) >= MAX_TOPICS_PER_CLIENT {
+		return nil, &models.RpcError{Status: http.StatusTooManyRequests, Message: "too many topics"}
+	}
+	client.topics[request.Topic] = true
+	return &request, nil
+}
+
+func (hub *Hub) unsubscribeFrame(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+	var request TopicFrame
+	if err := json.Unmarshal(payload, &request); err != nil || request.Topic == "" {
+		return nil, &models.RpcError{Status: http.StatusBadRequest, Message: "topic is required"}
+	}
+
+	hub.lock.Lock()
+	delete(client.topics, request.Topic)
+	expired := hub.takeSignals(client, request.Topic)
+	hub.lock.Unlock()
+
+	hub.expireSignals(client, expired)
+	return &request, nil
+}
+
+// signalFrame relays an ephemeral signal to the other subscribers of its
+// topic, which the sender must be subscribed to.
+func (hub *Hub) signalFrame(ctx context.Context, client *Client, payload json.RawMessage) (interface{}, error) {
+	if client.userId == "" {
+		return nil, &models.RpcError{Status: http.StatusUnauthorized, Message: "authentication required"}
+	}
+	var signal models.SignalPayload
+	if err := json.Unmarshal(payload, &signal); err != nil {
+		return nil, &models.RpcError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	if signal.Topic == "" || !signalKinds[signal.Kind] {
+		return nil, &models.RpcError{Status: http.StatusBadRequest, Message: "invalid topic or kind"}
+	}
+	if len(signal.Data) > MAX_SIGNAL_DATA_SIZE {
+		return nil, &models.RpcError{Status: http.StatusRequestEntityTooLarge, Message: "signal data too large"}
+	}
+
+	hub.lock.Lock()
+	if !client.topics[signal.Topic] {
+		hub.lock.Unlock()
+		return nil, &models.RpcError{Status: http.StatusForbidden, Message: "not subscribed to topic"}
+	}
+	if !client.limiter.allow() {
+		hub.lock.Unlock()
+		return nil, &models.RpcError{Status: http.StatusTooManyRequests, Message: "slow down"}
+	}
+	signal.UserId = client.userId
+	key := signal.Topic + "|" + signal.Kind
+	if previous, ok := client.signals[key]; ok {
+		previous.timer.Stop()
+		delete(client.signals, key)
+	}
+	if signal.Active {
+		signal.ExpiresIn = int(hub.signalTTL / time.Second)
+		active := &activeSignal{payload: signal}
+		active.timer = time.AfterFunc(hub.signalTTL, func() {
+			hub.expireSignal(client, key, active)
+		})
+		client.signals[key] = active
+	} else {
+		signal.ExpiresIn = 0
+	}
+	hub.lock.Unlock()
+
+	hub.sendSignal(client, signal)
+	return nil, nil
+}
+
+func (hub *Hub) sendSignal(client *Client, signal models.SignalPayload) {
+	hub.send(models.WebsocketMessage{
+		Type:    models.SIGNAL,
+		Payload: signal,
+	}, client, audience{Topic: signal.Topic, SenderIds: []string{signal.UserId}, Ephemeral: true})
+}
+
+// takeSignals removes the active signals of client, only the ones on topic
+// unless it is empty. It must be called with the hub lock held.
+func (hub *Hub) takeSignals(client *Client, topic string) []models.SignalPayload {
+	var taken []models.SignalPayload
+	for key, active := range client.signals {
+		if topic != "" && active.payload.Topic != topic {
+			continue
+		}
+		active.timer.Stop()
+		delete(client.signals, key)
+		taken = append(taken, active.payload)
+	}
+	return taken
+}
+
+// expireSignal stops a signal the client did not refresh in time, unless it
+// was refreshed or stopped in the meantime.
+func (hub *Hub) expireSignal(client *Client, key string, active *activeSignal) {
+	hub.lock.Lock()
+	if client.signals[key] != active {
+		hub.lock.Unlock()
+		return
+	}
+	delete(client.signals, key)
+	hub.lock.Unlock()
+
+	hub.expireSignals(client, []models.SignalPayload{active.payload})
+}
+
+// expireSignals tells the other subscribers that the signals are over.
+func (hub *Hub) expireSignals(client *Client, signals []models.SignalPayload) {
+	for _, signal := range signals {
+		signal.Active = false
+		signal.Data = nil
+		signal.ExpiresIn = 0
+		hub.sendSignal(client, signal)
+	}
+}
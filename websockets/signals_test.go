@@ -0,0 +1,141 @@
+package websockets
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// allowed counts the tokens the limiter hands out in a row.
+func allowed(limiter *rateLimiter) int {
+	count := 0
+	for limiter.allow() {
+		count++
+	}
+	return count
+}
+
+func TestRateLimiterAllowsBurst(t *testing.T) {
+	limiter := newRateLimiter(SIGNAL_RATE, SIGNAL_BURST)
+	if got := allowed(limiter); got != SIGNAL_BURST {
+		t.Errorf("allowed %d signals, want %d", got, SIGNAL_BURST)
+	}
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	limiter := newRateLimiter(SIGNAL_RATE, SIGNAL_BURST)
+	allowed(limiter)
+
+	// rewinding the last refill stands in for the time passing
+	limiter.last = limiter.last.Add(-time.Second)
+	if got := allowed(limiter); got != SIGNAL_RATE {
+		t.Errorf("allowed %d signals after a second, want %d", got, SIGNAL_RATE)
+	}
+
+	limiter.last = limiter.last.Add(-time.Hour)
+	if got := allowed(limiter); got != SIGNAL_BURST {
+		t.Errorf("allowed %d signals after an hour, want the burst of %d", got, SIGNAL_BURST)
+	}
+}
+
+func newSignalHub(ttl time.Duration) *Hub {
+	hub := NewHub()
+	hub.AuthorizeTopics(func(ctx context.Context, userId string, topic string) (bool, error) {
+		return true, nil
+	})
+	hub.signalTTL = ttl
+	go hub.Run()
+	return hub
+}
+
+func subscribe(t *testing.T, hub *Hub, client *Client, topic string) {
+	t.Helper()
+	payload, _ := json.Marshal(TopicFrame{Topic: topic})
+	if _, err := hub.subscribeFrame(context.Background(), client, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func signal(t *testing.T, hub *Hub, client *Client, active bool) {
+	t.Helper()
+	payload, _ := json.Marshal(models.SignalPayload{Topic: "conversation:1", Kind: "typing", Active: active})
+	if _, err := hub.signalFrame(context.Background(), client, payload); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receiveSignal returns the next signal queued for client.
+func receiveSignal(t *testing.T, client *Client) models.SignalPayload {
+	t.Helper()
+	message := receive(t, client)
+	if message.Type != models.SIGNAL {
+		t.Fatalf("got %q, want a signal", message.Type)
+	}
+	data, _ := json.Marshal(message.Payload)
+	var payload models.SignalPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	return payload
+}
+
+func TestSignalExpires(t *testing.T) {
+	hub := newSignalHub(50 * time.Millisecond)
+	alice, bob := connect(hub, "alice", nil), connect(hub, "bob", nil)
+	subscribe(t, hub, alice, "conversation:1")
+	subscribe(t, hub, bob, "conversation:1")
+
+	signal(t, hub, alice, true)
+	if got := receiveSignal(t, bob); !got.Active || got.UserId != "alice" {
+		t.Fatalf("got %+v, want alice typing", got)
+	}
+	started := time.Now()
+	if got := receiveSignal(t, bob); got.Active || got.Kind != "typing" || got.UserId != "alice" {
+		t.Fatalf("got %+v, want alice stopped typing", got)
+	}
+	if elapsed := time.Since(started); elapsed < 40*time.Millisecond {
+		t.Errorf("the signal expired after %v", elapsed)
+	}
+}
+
+func TestSignalRefreshPostponesExpiry(t *testing.T) {
+	hub := newSignalHub(100 * time.Millisecond)
+	alice, bob := connect(hub, "alice", nil), connect(hub, "bob", nil)
+	subscribe(t, hub, alice, "conversation:1")
+	subscribe(t, hub, bob, "conversation:1")
+
+	signal(t, hub, alice, true)
+	receiveSignal(t, bob)
+	time.Sleep(60 * time.Millisecond)
+	signal(t, hub, alice, true)
+	refreshed := time.Now()
+	receiveSignal(t, bob)
+
+	if got := receiveSignal(t, bob); got.Active {
+		t.Fatalf("got %+v, want the signal stopped", got)
+	}
+	if elapsed := time.Since(refreshed); elapsed < 80*time.Millisecond {
+		t.Errorf("the signal expired %v after being refreshed", elapsed)
+	}
+}
+
+func TestStoppedSignalDoesNotExpire(t *testing.T) {
+	hub := newSignalHub(20 * time.Millisecond)
+	alice, bob := connect(hub, "alice", nil), connect(hub, "bob", nil)
+	subscribe(t, hub, alice, "conversation:1")
+	subscribe(t, hub, bob, "conversation:1")
+
+	signal(t, hub, alice, true)
+	signal(t, hub, alice, false)
+	receiveSignal(t, bob)
+	receiveSignal(t, bob)
+
+	time.Sleep(60 * time.Millisecond)
+	hub.Broadcast(models.WebsocketMessage{Type: "next"}, nil)
+	if got := receive(t, bob); got.Type != "next" {
+		t.Errorf("got %q after the signal stopped, want next", got.Type)
+	}
+}
@@ -0,0 +1,67 @@
+package websockets
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	EVENT_STREAM_KEEPALIVE = 30 * time.Second
+)
+
+// HandleEventStream serves the hub events as Server-Sent Events for clients
+// that cannot upgrade to a websocket. It honors the Last-Event-ID header the
+// same way HandleWebSocket honors last_event_id.
+func (hub *Hub) HandleEventStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	lastEventId, err := parseLastEventId(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	client := newClient(hub, r.RemoteAddr)
+	client.userId = userIdFromRequest(r)
+	client.lastEventId = lastEventId
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	hub.register <- client
+
+	keepalive := time.NewTicker(EVENT_STREAM_KEEPALIVE)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case event, ok := <-client.outbound:
+			if !ok {
+				return
+			}
+			if event.id != 0 {
+				fmt.Fprintf(w, "id: %d\n", event.id)
+			}
+			fmt.Fprintf(w, "data: %s\n\n", event.message.json)
+			flusher.Flush()
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case <-r.Context().Done():
+			hub.unregister <- client
+			return
+		}
+	}
+}
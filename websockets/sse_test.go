@@ -0,0 +1,150 @@
+package websockets
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrisongomez/project-go/models"
+)
+
+// waitForClients waits until count clients are registered with the hub.
+func waitForClients(t *testing.T, hub *Hub, count int) {
+	t.Helper()
+	deadline := time.Now().Add(receiveTimeout)
+	for time.Now().Before(deadline) {
+		hub.lock.Lock()
+		registered := len(hub.clients)
+		hub.lock.Unlock()
+		if registered == count {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("the hub does not have %d clients", count)
+}
+
+type streamEvent struct {
+	id   string
+	data string
+}
+
+// openStream connects to the event stream, resuming after lastEventId unless
+// it is empty.
+func openStream(t *testing.T, ctx context.Context, url string, lastEventId string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	request, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if lastEventId != "" {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return response, bufio.NewReader(response.Body)
+}
+
+// readEvent reads the next event of the stream, skipping comments.
+func readEvent(t *testing.T, reader *bufio.Reader) streamEvent {
+	t.Helper()
+	var e streamEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && e.data != "":
+			return e
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		case line == "" || strings.HasPrefix(line, ":"):
+		default:
+			t.Fatalf("unexpected line %q", line)
+		}
+	}
+}
+
+func messageOf(t *testing.T, e streamEvent) models.WebsocketMessage {
+	t.Helper()
+	var message models.WebsocketMessage
+	if err := json.Unmarshal([]byte(e.data), &message); err != nil {
+		t.Fatal(err)
+	}
+	return message
+}
+
+func TestEventStream(t *testing.T) {
+	hub := newTestHub(NewLocalBackplane())
+	server := httptest.NewServer(http.HandlerFunc(hub.HandleEventStream))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	response, reader := openStream(t, ctx, server.URL, "")
+	if got := response.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Errorf("content type %q", got)
+	}
+	if got := response.Header.Get("Cache-Control"); got != "no-cache" {
+		t.Errorf("cache control %q", got)
+	}
+	waitForClients(t, hub, 1)
+
+	hub.Broadcast(models.WebsocketMessage{Type: "one"}, nil)
+	hub.Broadcast(models.WebsocketMessage{Type: "two"}, nil)
+	first, second := readEvent(t, reader), readEvent(t, reader)
+	if message := messageOf(t, first); message.Type != "one" || first.id != strconv.FormatUint(message.Id, 10) {
+		t.Errorf("got id %s for %+v", first.id, message)
+	}
+	if message := messageOf(t, second); message.Type != "two" || second.id != strconv.FormatUint(message.Id, 10) {
+		t.Errorf("got id %s for %+v", second.id, message)
+	}
+
+	cancel()
+	response.Body.Close()
+	waitForClients(t, hub, 0)
+}
+
+func TestEventStreamResumes(t *testing.T) {
+	hub := newTestHub(NewLocalBackplane())
+	server := httptest.NewServer(http.HandlerFunc(hub.HandleEventStream))
+	defer server.Close()
+	watcher := connect(hub, "", nil)
+
+	var ids []string
+	for _, messageType := range []string{"one", "two", "three"} {
+		hub.Broadcast(models.WebsocketMessage{Type: messageType}, nil)
+		ids = append(ids, strconv.FormatUint(receive(t, watcher).Id, 10))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	response, reader := openStream(t, ctx, server.URL, ids[0])
+	defer response.Body.Close()
+	for i, want := range []string{"two", "three"} {
+		e := readEvent(t, reader)
+		if message := messageOf(t, e); message.Type != want || e.id != ids[i+1] {
+			t.Errorf("replayed %q with id %s, want %q with id %s", message.Type, e.id, want, ids[i+1])
+		}
+	}
+}
+
+func TestEventStreamRejectsInvalidLastEventId(t *testing.T) {
+	hub := newTestHub(NewLocalBackplane())
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/events", nil)
+	request.Header.Set("Last-Event-ID", "yesterday")
+	hub.HandleEventStream(recorder, request)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400", recorder.Code)
+	}
+}